@@ -0,0 +1,119 @@
+package core
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+// AnewSink appends never-before-seen assets to plain text files, one per line, for other tools to watch:
+// new_scope.txt, new_subdomains.txt and new_live_urls.txt.
+type AnewSink struct {
+	Dir   string
+	mutex sync.Mutex
+	seen  map[string]map[string]bool
+}
+
+// NewAnewSink function creates the output directory and returns a sink writing to it.
+func NewAnewSink(dir string) (*AnewSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &AnewSink{Dir: dir, seen: make(map[string]map[string]bool)}, nil
+}
+
+// Write function appends the assets an event introduces to the matching files.
+func (a *AnewSink) Write(event model.Event) error {
+	switch event.Type {
+	case model.EventScopeNew:
+		return a.append("new_scope.txt", event.Asset)
+	case model.EventServiceNew:
+		if err := a.append("new_subdomains.txt", hostOf(event.Asset)); err != nil {
+			return err
+		}
+		if event.Service != nil && event.Service.Status {
+			return a.append("new_live_urls.txt", event.Asset)
+		}
+	case model.EventServiceStatus:
+		if event.New == "true" {
+			return a.append("new_live_urls.txt", event.Asset)
+		}
+	}
+
+	return nil
+}
+
+// append function adds a line to a file unless the file already has it.
+func (a *AnewSink) append(name string, line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	path := filepath.Join(a.Dir, name)
+	if a.seen[name] == nil {
+		seen, err := readLines(path)
+		if err != nil {
+			return err
+		}
+		a.seen[name] = seen
+	}
+
+	if a.seen[name][line] {
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(line + "\n"); err != nil {
+		return err
+	}
+	a.seen[name][line] = true
+
+	return nil
+}
+
+// readLines function returns the set of lines in a file, empty if it does not exist yet.
+func readLines(path string) (map[string]bool, error) {
+	lines := make(map[string]bool)
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return lines, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines[line] = true
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// hostOf function returns the host name of a service URL.
+func hostOf(service string) string {
+	if parsed, err := url.Parse(service); err == nil && parsed.Hostname() != "" {
+		return parsed.Hostname()
+	}
+
+	return service
+}
@@ -0,0 +1,416 @@
+package core
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// archiveFormat is bumped whenever the layout of an export archive changes.
+const archiveFormat = 1
+
+// manifestName is the first entry of every archive, listing the others with their checksums.
+const manifestName = "manifest.json"
+
+var queueEntry = regexp.MustCompile(`^queue/[0-9]+-[0-9]+\.json$`)
+
+// manifest describes the content of an export archive.
+type manifest struct {
+	Format  int            `json:"format"`
+	Created time.Time      `json:"created"`
+	Files   []manifestFile `json:"files"`
+}
+
+type manifestFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Export function writes all state of the data directory to a gzipped tar archive: the state files, a snapshot of
+// the database, and the queued events. Every file is listed in the manifest with its SHA-256 checksum.
+func Export(o *Options) error {
+	if _, err := os.Stat(o.DataDir); err != nil {
+		return fmt.Errorf("no state in %s", o.DataDir)
+	}
+
+	staging, err := os.MkdirTemp(o.DataDir, ".export-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	files, err := exportFiles(o.DataDir, staging)
+	if err != nil {
+		return err
+	}
+
+	archive := manifest{Format: archiveFormat, Created: time.Now().UTC()}
+	for _, name := range sortedKeys(files) {
+		sum, size, err := hashFile(files[name])
+		if err != nil {
+			return err
+		}
+		archive.Files = append(archive.Files, manifestFile{Name: name, Size: size, SHA256: sum})
+	}
+
+	temp := o.Archive + ".tmp"
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp)
+
+	if err := writeArchive(file, archive, files); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, o.Archive); err != nil {
+		return err
+	}
+
+	fmt.Printf("\033[32m[+] Exported %d Files To %s\033[0m\n", len(archive.Files), o.Archive)
+	return nil
+}
+
+// Import function loads an archive made by Export into the data directory. Every file is checked against the
+// manifest before anything is replaced, and existing state is only overwritten with Force.
+func Import(o *Options) error {
+	if !o.Force {
+		for _, name := range append(sortedKeys(stateFiles), databaseName) {
+			if _, err := os.Stat(filepath.Join(o.DataDir, name)); err == nil {
+				return fmt.Errorf("%s already holds state (%s), use -force to replace it", o.DataDir, name)
+			}
+		}
+		if pending := queuedEvents(o.DataDir); pending > 0 {
+			return fmt.Errorf("%s already holds %d queued events, use -force to replace them", o.DataDir, pending)
+		}
+	}
+
+	staging, err := os.MkdirTemp(o.DataDir, ".import-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	archive, err := readArchive(o.Archive, staging)
+	if err != nil {
+		return fmt.Errorf("%s: %w", o.Archive, err)
+	}
+
+	for _, entry := range archive.Files {
+		if kind, ok := stateFiles[entry.Name]; ok {
+			var value any
+			data, err := os.ReadFile(filepath.Join(staging, entry.Name))
+			if err == nil {
+				_, err = decodeState(data, kind, &value)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", entry.Name, err)
+			}
+		}
+	}
+
+	if err := clearState(o.DataDir); err != nil {
+		return err
+	}
+
+	for _, entry := range archive.Files {
+		target := filepath.Join(o.DataDir, filepath.FromSlash(entry.Name))
+		if err := os.Rename(filepath.Join(staging, filepath.FromSlash(entry.Name)), target); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("\033[32m[+] Imported %d Files From %s (Exported %s)\033[0m\n", len(archive.Files), o.Archive, archive.Created.Format(time.RFC3339))
+	return nil
+}
+
+// clearState function removes all state of the data directory, so nothing of the replaced instance survives an
+// import: the state files and their backups, which readState would restore from, the database with its write-ahead
+// log, which would be replayed into an imported one, and the queue, whose events would still be delivered.
+func clearState(dir string) error {
+	var paths []string
+	for name := range stateFiles {
+		paths = append(paths, filepath.Join(dir, name), filepath.Join(dir, name+backupSuffix))
+	}
+	database := filepath.Join(dir, databaseName)
+	paths = append(paths, database, database+"-wal", database+"-shm")
+
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(filepath.Join(dir, "queue")); err != nil {
+		return err
+	}
+
+	return os.MkdirAll(filepath.Join(dir, "queue", "failed"), 0755)
+}
+
+// queuedEvents function counts the events waiting in the queue of the data directory.
+func queuedEvents(dir string) int {
+	entries, _ := os.ReadDir(filepath.Join(dir, "queue"))
+
+	count := 0
+	for _, entry := range entries {
+		if !entry.IsDir() && queueEntry.MatchString("queue/"+entry.Name()) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// exportFiles function copies the files to export into the staging directory and lists the copies by their name in
+// the archive. The database is snapshotted and every other file copied first, so a running instance cannot change or
+// remove them between hashing and archiving.
+func exportFiles(dir string, staging string) (map[string]string, error) {
+	files := make(map[string]string)
+
+	for name := range stateFiles {
+		copied, err := stageFile(filepath.Join(dir, name), filepath.Join(staging, name))
+		if err != nil {
+			return nil, err
+		}
+		if copied {
+			files[name] = filepath.Join(staging, name)
+		}
+	}
+
+	database := filepath.Join(dir, databaseName)
+	if _, err := os.Stat(database); err == nil {
+		store, err := OpenSQLiteStoreReadOnly(database)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot := filepath.Join(staging, databaseName)
+		_, err = store.db.Exec("VACUUM INTO ?", snapshot)
+		store.Close()
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %s: %w", databaseName, err)
+		}
+		files[databaseName] = snapshot
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "queue"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(staging, "queue"), 0755); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := "queue/" + entry.Name()
+		if entry.IsDir() || !queueEntry.MatchString(name) {
+			continue
+		}
+
+		// An event delivered since the directory was listed is gone, and rightly left out.
+		copied, err := stageFile(filepath.Join(dir, "queue", entry.Name()), filepath.Join(staging, "queue", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if copied {
+			files[name] = filepath.Join(staging, "queue", entry.Name())
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no state in %s", dir)
+	}
+
+	return files, nil
+}
+
+// stageFile function copies src to dst, reporting false if src does not exist. State files are replaced by rename,
+// so the copy is always of one whole version.
+func stageFile(src string, dst string) (bool, error) {
+	in, err := os.Open(src)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err == nil, err
+}
+
+// writeArchive function writes the manifest and then every file to a gzipped tar stream.
+func writeArchive(w io.Writer, archive manifest, files map[string]string) error {
+	compressed := gzip.NewWriter(w)
+	writer := tar.NewWriter(compressed)
+
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: manifestName, Mode: 0644, Size: int64(len(data)), ModTime: archive.Created}
+	if err := writer.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+
+	for _, entry := range archive.Files {
+		if err := copyToArchive(writer, entry, files[entry.Name], archive.Created); err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return compressed.Close()
+}
+
+func copyToArchive(writer *tar.Writer, entry manifestFile, path string, modified time.Time) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := writer.WriteHeader(&tar.Header{Name: entry.Name, Mode: 0644, Size: entry.Size, ModTime: modified}); err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(writer, file, entry.Size)
+	return err
+}
+
+// readArchive function extracts an archive into the staging directory and checks every file against the manifest.
+func readArchive(path string, staging string) (manifest, error) {
+	var archive manifest
+
+	file, err := os.Open(path)
+	if err != nil {
+		return archive, err
+	}
+	defer file.Close()
+
+	compressed, err := gzip.NewReader(file)
+	if err != nil {
+		return archive, err
+	}
+	reader := tar.NewReader(compressed)
+
+	header, err := reader.Next()
+	if err != nil || header.Name != manifestName {
+		return archive, errors.New("not a ScopeDetective export, the manifest is missing")
+	}
+	if err := json.NewDecoder(reader).Decode(&archive); err != nil {
+		return archive, fmt.Errorf("manifest: %w", err)
+	}
+	if archive.Format > archiveFormat {
+		return archive, fmt.Errorf("%w (archive format %d, this one reads up to %d)", errFutureState, archive.Format, archiveFormat)
+	}
+
+	expected := make(map[string]manifestFile)
+	for _, entry := range archive.Files {
+		if _, ok := stateFiles[entry.Name]; !ok && entry.Name != databaseName && !queueEntry.MatchString(entry.Name) {
+			return archive, fmt.Errorf("unexpected file %s", entry.Name)
+		}
+		expected[entry.Name] = entry
+	}
+
+	if err := os.MkdirAll(filepath.Join(staging, "queue"), 0755); err != nil {
+		return archive, err
+	}
+
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return archive, err
+		}
+
+		entry, ok := expected[header.Name]
+		if !ok {
+			return archive, fmt.Errorf("%s is not listed in the manifest", header.Name)
+		}
+		delete(expected, header.Name)
+
+		sum, size, err := extractFile(reader, filepath.Join(staging, filepath.FromSlash(header.Name)))
+		if err != nil {
+			return archive, err
+		}
+		if size != entry.Size || sum != entry.SHA256 {
+			return archive, fmt.Errorf("checksum mismatch for %s, the archive is damaged", header.Name)
+		}
+	}
+
+	if len(expected) > 0 {
+		return archive, fmt.Errorf("%s listed in the manifest but missing", sortedKeys(expected)[0])
+	}
+
+	return archive, nil
+}
+
+// extractFile function writes one archive entry to path and returns its checksum and size.
+func extractFile(reader io.Reader, path string) (string, int64, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", 0, err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), reader)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), size, err
+}
+
+// hashFile function returns the SHA-256 checksum and size of a file.
+func hashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+
+	return hex.EncodeToString(hash.Sum(nil)), size, err
+}
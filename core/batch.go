@@ -0,0 +1,168 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+// Discord rejects messages above these limits.
+const (
+	maxEmbeds           = 10
+	maxMessageChars     = 6000
+	maxDescriptionChars = 4096
+)
+
+// summaryThreshold is the size from which a group is summarized with an attached report instead of sent as embeds:
+// past five full messages, a burst such as a new program's whole scope floods the channel more than it informs.
+const summaryThreshold = 5 * maxEmbeds
+
+// groupEvents function groups events per program or monitored domain, keeping the queue order.
+func groupEvents(events []model.Event) [][]model.Event {
+	var order []string
+	groups := make(map[string][]model.Event)
+
+	for _, event := range events {
+		key := groupKey(event)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], event)
+	}
+
+	var result [][]model.Event
+	for _, key := range order {
+		result = append(result, groups[key])
+	}
+
+	return result
+}
+
+// chunkEvents function splits a group into chunks that fit in one message each.
+func (m *Messager) chunkEvents(group []model.Event) [][]model.Event {
+	var chunks [][]model.Event
+	var chunk []model.Event
+	size := 0
+
+	for _, event := range group {
+		chars := embedSize(m.embed(event))
+		if len(chunk) > 0 && (len(chunk) == maxEmbeds || size+chars > maxMessageChars) {
+			chunks = append(chunks, chunk)
+			chunk, size = nil, 0
+		}
+		chunk = append(chunk, event)
+		size += chars
+	}
+
+	return append(chunks, chunk)
+}
+
+// groupKey function returns the name events are batched under: the program for scope events, the monitored domain
+// for subdomain events.
+func groupKey(event model.Event) string {
+	switch {
+	case event.Type == model.EventLog:
+		return "log"
+	case event.Program != "":
+		return "program:" + event.Program
+	}
+
+	return "domain:" + event.Domain
+}
+
+// embedSize function counts the characters Discord charges an embed against the message limit.
+func embedSize(embed model.DiscordEmbed) int {
+	size := len([]rune(embed.Title)) + len([]rune(embed.Description))
+	for _, field := range embed.Fields {
+		size += len([]rune(field.Name)) + len([]rune(field.Value))
+	}
+	if embed.Footer != nil {
+		size += len([]rune(embed.Footer.Text))
+	}
+
+	return size
+}
+
+// digestMessage function summarises held events in one embed and attaches the full report.
+func (m *Messager) digestMessage(events []model.Event) (model.DiscordMessage, Attachment) {
+	title := fmt.Sprintf("📬 Digest: %d Events Since %s", len(events), events[0].Time.Format("2006-01-02 15:04"))
+	return m.summaryMessage(title, events)
+}
+
+// summaryMessage function counts events per type and program in one embed, attaching the full change set as a
+// report file in the configured format.
+func (m *Messager) summaryMessage(title string, events []model.Event) (model.DiscordMessage, Attachment) {
+	perType := make(map[model.EventType]int)
+	perProgram := make(map[string]int)
+
+	for _, event := range events {
+		perType[event.Type]++
+		if name := threadName(groupKey(event)); name != "" {
+			perProgram[name]++
+		}
+	}
+
+	file := report(m.Options.Report, events)
+
+	description := &strings.Builder{}
+	description.WriteString("```yaml\n")
+	for _, kind := range sortedKeys(perType) {
+		fmt.Fprintf(description, " - %s: %d\n", kind, perType[kind])
+	}
+	description.WriteString("```")
+
+	programs := sortedKeys(perProgram)
+	sort.SliceStable(programs, func(i, j int) bool { return perProgram[programs[i]] > perProgram[programs[j]] })
+	if len(programs) > 1 {
+		for _, program := range programs {
+			line := fmt.Sprintf("\n- %s: %d", program, perProgram[program])
+			if description.Len()+len(line) > maxDescriptionChars-64 {
+				description.WriteString("\n- …")
+				break
+			}
+			description.WriteString(line)
+		}
+	}
+	fmt.Fprintf(description, "\n📎 Full report: `%s`", file.Name)
+
+	embed := model.DiscordEmbed{
+		Title:       truncate(title, maxFieldName),
+		Description: description.String(),
+		Color:       eventColor(events[0]),
+		Timestamp:   time.Now().Format(time.RFC3339),
+		Footer:      &model.DiscordEmbedFooter{Text: fmt.Sprintf("%s • run %s", events[0].Source, events[0].RunID)},
+	}
+
+	return m.message(embed), file
+}
+
+// oversized function reports whether any event has a value longer than an embed field can show.
+func oversized(events []model.Event) bool {
+	for _, event := range events {
+		values := []string{event.Old, event.New, event.Instruction}
+		if event.Service != nil {
+			values = append(values, event.Service.Title, strings.Join(event.Service.Technology, ", "))
+		}
+
+		for _, value := range values {
+			if len([]rune(value)) > maxFieldValue {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func sortedKeys[K ~string, V any](data map[K]V) []K {
+	keys := make([]K, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	return keys
+}
@@ -0,0 +1,219 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+const (
+	// Discord's error code for a message that no longer exists.
+	unknownMessage = "10008"
+	cardHistory    = 10
+)
+
+// Card is the status message kept up to date for one service.
+type Card struct {
+	MessageID string   `json:"message_id"`
+	ThreadID  string   `json:"thread_id,omitempty"`
+	History   []string `json:"history"`
+}
+
+// CardStore remembers the status card of every service URL, per destination.
+type CardStore struct {
+	path  string
+	mutex sync.Mutex
+	cards map[string]map[string]Card
+}
+
+// NewCardStore function loads the cards saved at path, starting empty if there are none or they cannot be read.
+// Cards written by a newer release are an error, so they are not overwritten.
+func NewCardStore(path string) (*CardStore, error) {
+	store := &CardStore{path: path, cards: make(map[string]map[string]Card)}
+
+	if err := readState(path, stateCards, &store.cards); err != nil {
+		if errors.Is(err, errFutureState) {
+			return nil, err
+		}
+		fmt.Printf("\033[31m[!] Error loading message IDs, starting new cards: %s\033[0m\n", err)
+		store.cards = make(map[string]map[string]Card)
+	}
+
+	return store, nil
+}
+
+// Get function returns the card of a service in a destination.
+func (c *CardStore) Get(destination string, service string) Card {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.cards[destination][service]
+}
+
+// Set function records a card and saves the store.
+func (c *CardStore) Set(destination string, service string, card Card) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.cards[destination] == nil {
+		c.cards[destination] = make(map[string]Card)
+	}
+	c.cards[destination][service] = card
+
+	if err := writeState(c.path, stateCards, c.cards); err != nil {
+		fmt.Printf("\033[31m[!] Save Message IDs Error: %s\033[0m\n", err)
+	}
+}
+
+// serviceCards function splits service events off, grouped per service URL in queue order, and returns the rest.
+func serviceCards(events []model.Event) ([][]model.Event, []model.Event) {
+	var order []string
+	services := make(map[string][]model.Event)
+	var rest []model.Event
+
+	for _, event := range events {
+		if event.Service == nil {
+			rest = append(rest, event)
+			continue
+		}
+
+		if _, ok := services[event.Asset]; !ok {
+			order = append(order, event.Asset)
+		}
+		services[event.Asset] = append(services[event.Asset], event)
+	}
+
+	var cards [][]model.Event
+	for _, service := range order {
+		cards = append(cards, services[service])
+	}
+
+	return cards, rest
+}
+
+// sendCard function delivers the events of one service as its status card: the existing card is edited in place,
+// and a new one is posted when there is none yet or it was deleted. It reports false when Discord is unreachable.
+func (m *Messager) sendCard(chain []string, events []model.Event) bool {
+	base := m.message()
+	rules := m.mention(&base, events)
+
+	err := m.deliver(chain, events, func(name string, destination Destination) error {
+		if !destination.Edit {
+			payload := m.message(m.cardEmbed(events, nil))
+			payload.Content, payload.AllowedMentions = base.Content, base.AllowedMentions
+			_, err := m.post(name, destination, threadKey(events), payload)
+			return err
+		}
+
+		service := events[0].Asset
+		card := m.cards.Get(name, service)
+		for _, event := range events {
+			card.History = append(card.History, historyLine(event))
+		}
+		if len(card.History) > cardHistory {
+			card.History = card.History[len(card.History)-cardHistory:]
+		}
+
+		payload := m.message(m.cardEmbed(events, card.History))
+		payload.Content, payload.AllowedMentions = base.Content, base.AllowedMentions
+
+		if card.MessageID != "" {
+			err := m.editMessage(destination, card, payload)
+			if err == nil || !isUnknownMessage(err) {
+				if err == nil {
+					m.cards.Set(name, service, card)
+				}
+				return err
+			}
+		}
+
+		posted, err := m.post(name, destination, threadKey(events), payload)
+		if err != nil {
+			return err
+		}
+
+		card.MessageID = posted.ID
+		if destination.Forum {
+			card.ThreadID = posted.ChannelID
+		}
+		m.cards.Set(name, service, card)
+
+		return nil
+	})
+	if err == nil {
+		m.markPinged(rules)
+	}
+
+	return err == nil || errors.Is(err, errPermanent)
+}
+
+// editMessage function replaces the content of a message the webhook posted earlier.
+func (m *Messager) editMessage(destination Destination, card Card, payload model.DiscordMessage) error {
+	webhook := strings.TrimRight(strings.SplitN(destination.Webhook, "?", 2)[0], "/") + "/messages/" + card.MessageID
+	if card.ThreadID != "" {
+		webhook = withQuery(webhook, "thread_id", card.ThreadID)
+	}
+
+	// Edits cannot change the author, and Discord rejects thread_name on them.
+	payload.Username, payload.AvatarUrl, payload.ThreadName = "", "", ""
+
+	_, err := m.delivery.Do("PATCH", webhook, payload)
+	return err
+}
+
+// cardEmbed function shows the latest state of a service, followed by its recent changes.
+func (m *Messager) cardEmbed(events []model.Event, history []string) model.DiscordEmbed {
+	last := events[len(events)-1]
+	service := last.Service
+
+	embed := model.DiscordEmbed{
+		Title:     truncate("📟 "+last.Asset, maxFieldName),
+		Url:       last.Asset,
+		Color:     eventColors[model.EventServiceNew],
+		Timestamp: last.Time.Format(time.RFC3339),
+		Fields: []model.DiscordEmbedField{
+			field("Title", service.Title, true),
+			field("Status", yesNo(service.Status), true),
+			field("Code", strings.Join(service.Code, " → "), true),
+			field("Words", strconv.Itoa(service.Words), true),
+			field("Technology", strings.Join(service.Technology, ", "), false),
+		},
+		Footer: &model.DiscordEmbedFooter{Text: fmt.Sprintf("%s • run %s", last.Source, last.RunID)},
+	}
+	if !service.Status {
+		embed.Color = severityColors["critical"]
+	}
+
+	if len(history) == 0 {
+		for _, event := range events {
+			history = append(history, historyLine(event))
+		}
+	}
+	embed.Fields = append(embed.Fields, field("History", strings.Join(history, "\n"), false))
+
+	return embed
+}
+
+// historyLine function describes one change of a service for its card.
+func historyLine(event model.Event) string {
+	when := event.Time.UTC().Format("2006-01-02 15:04")
+	if event.Type == model.EventServiceNew {
+		return when + " · first seen"
+	}
+
+	return fmt.Sprintf("%s · %s: %s → %s", when, strings.TrimPrefix(string(event.Type), "service_"), event.Old, event.New)
+}
+
+func isUnknownMessage(err error) bool {
+	var status *statusError
+	if !errors.As(err, &status) {
+		return false
+	}
+
+	return status.Status == 404 || strings.Contains(status.Body, unknownMessage)
+}
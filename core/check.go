@@ -0,0 +1,178 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+var webhookPattern = regexp.MustCompile(`^https://(?:(?:ptb|canary)\.)?discord(?:app)?\.com/api(?:/v\d+)?/webhooks/\d+/[\w-]+/?$`)
+
+// CheckWebhooks function validates the format of every configured webhook and asks Discord whether it exists. A
+// webhook Discord does not know is an error; an unreachable Discord is only reported, since it may be temporary.
+func CheckWebhooks(o *Options) error {
+	m := &Messager{Options: o, delivery: NewDelivery()}
+
+	for _, name := range m.destinations() {
+		destination, _ := m.destination(name)
+
+		err := m.delivery.Check(destination.Webhook)
+		switch {
+		case errors.Is(err, errPermanent):
+			return fmt.Errorf("destination %s: %w", name, err)
+		case err != nil:
+			fmt.Printf("\033[33m[!] Can't Verify Destination %s: %s\033[0m\n", name, err)
+		}
+	}
+
+	return nil
+}
+
+// TestNotify function sends a sample of every event type to every configured destination and prints the outcome
+// per destination. It returns an error unless there is at least one destination and all of them accepted the samples.
+func TestNotify(o *Options) error {
+	// test-notify runs without the data directory lock, so it must not write into state a running instance owns.
+	threads, err := NewReadOnlyThreadStore(filepath.Join(o.DataDir, "threads.json"))
+	if err != nil {
+		return err
+	}
+
+	m := &Messager{
+		Options:  o,
+		delivery: NewDelivery(),
+		threads:  threads,
+	}
+
+	var embeds []model.DiscordEmbed
+	for _, event := range sampleEvents() {
+		embeds = append(embeds, m.embed(event))
+	}
+	payload := m.message(embeds...)
+	payload.Content = "🧪 ScopeDetective test notification"
+
+	names := m.destinations()
+	if len(names) == 0 {
+		return errors.New("no destinations configured, set -webhook or destinations in the config file")
+	}
+
+	failed := 0
+	for _, name := range names {
+		destination, _ := m.destination(name)
+
+		err := m.delivery.Check(destination.Webhook)
+		if err == nil {
+			_, err = m.post(name, destination, "test", payload)
+		}
+
+		if err != nil {
+			failed++
+			fmt.Printf("\033[31m[!] %s: %s\033[0m\n", name, err)
+			continue
+		}
+		fmt.Printf("\033[32m[+] %s: OK\033[0m\n", name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d destinations failed", failed, len(names))
+	}
+
+	return nil
+}
+
+// Check function verifies a webhook URL looks like a Discord webhook and that Discord knows it.
+func (d *Delivery) Check(url string) error {
+	if !webhookPattern.MatchString(url) {
+		// The URL itself is not shown: if it is a webhook after all, it holds the token.
+		return fmt.Errorf("%w: not a Discord webhook URL, want https://discord.com/api/webhooks/ID/TOKEN", errPermanent)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errPermanent, redactError(err))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return redactError(err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusNotFound:
+		return &statusError{Status: resp.StatusCode, Body: "unknown webhook"}
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// destinations function lists the names of every destination with a webhook, in a stable order.
+func (m *Messager) destinations() []string {
+	var names []string
+	for name, destination := range m.Options.Config.Destinations {
+		if destination.Webhook != "" {
+			names = append(names, name)
+		}
+	}
+
+	if _, ok := m.Options.Config.Destinations[defaultDestination]; !ok && m.Options.Webhook != "" {
+		names = append(names, defaultDestination)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// sampleEvents function returns one made-up event of every type.
+func sampleEvents() []model.Event {
+	now := time.Now()
+	runID := newRunID()
+	service := &model.Sub{
+		Title:      "Example App",
+		URL:        "https://app.example.com",
+		Technology: []string{"Nginx", "React"},
+		Code:       []string{"301", "200"},
+		Words:      1337,
+		Status:     true,
+	}
+
+	base := model.Event{Time: now, Source: "test-notify", RunID: runID, Domain: "example.com", Asset: service.URL, Service: service}
+	events := []model.Event{
+		{Type: model.EventLog, Time: now, Message: "```yaml\n - 🧪 Detective Test Log ! ```"},
+		{
+			Type: model.EventScopeNew, Time: now, Source: "test-notify", RunID: runID,
+			Program: "Example Program", ProgramURL: "https://hackerone.com/example", Asset: "*.example.com",
+			AssetType: "URL", Severity: "critical", Bounty: true, Instruction: "This is a test notification.",
+		},
+	}
+
+	changes := []struct {
+		kind     model.EventType
+		old, new string
+	}{
+		{model.EventServiceNew, "", ""},
+		{model.EventServiceStatus, "false", "true"},
+		{model.EventServiceCode, "200", "301 → 200"},
+		{model.EventServiceWords, "1200", "1337"},
+		{model.EventServiceTech, "Nginx", "Nginx, React"},
+		{model.EventServiceTitle, "Old App", "Example App"},
+	}
+	for _, change := range changes {
+		event := base
+		event.Type, event.Old, event.New = change.kind, change.old, change.new
+		events = append(events, event)
+	}
+
+	return events
+}
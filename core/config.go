@@ -0,0 +1,185 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/NImaism/ScopeDetective/model"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultDestination is the destination backed by the -webhook flag.
+const defaultDestination = "default"
+
+// Config holds the settings that do not fit on the command line, loaded from the YAML file given with -config.
+type Config struct {
+	Destinations map[string]Destination `yaml:"destinations"`
+	Routes       []Route                `yaml:"routes"`
+	Default      string                 `yaml:"default"`
+	Mentions     []MentionRule          `yaml:"mentions"`
+	Hooks        []Hook                 `yaml:"hooks"`
+	HookLimit    int                    `yaml:"hook_concurrency"`
+}
+
+// Destination is a named place events can be delivered to.
+type Destination struct {
+	Webhook     string      `yaml:"webhook"`
+	WebhookEnv  string      `yaml:"webhook_env"`
+	WebhookFile string      `yaml:"webhook_file"`
+	Forum       bool        `yaml:"forum"`
+	Edit        bool        `yaml:"edit"`
+	QuietHours  *QuietHours `yaml:"quiet_hours"`
+}
+
+// Filter selects events; an event matches when it passes every non-empty list.
+type Filter struct {
+	Types      []model.EventType `yaml:"types"`
+	Programs   []string          `yaml:"programs"`
+	Severities []string          `yaml:"severities"`
+	Domains    []string          `yaml:"domains"`
+}
+
+// Route sends the events matching its filter to Destination, or to Fallback when that fails.
+type Route struct {
+	Name        string `yaml:"name"`
+	Filter      `yaml:",inline"`
+	Destination string `yaml:"destination"`
+	Fallback    string `yaml:"fallback"`
+}
+
+// MentionRule pings roles and users for the events matching its filter, at most once per Cooldown.
+type MentionRule struct {
+	Name     string `yaml:"name"`
+	Filter   `yaml:",inline"`
+	Roles    []string      `yaml:"roles"`
+	Users    []string      `yaml:"users"`
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// LoadConfig function reads and validates a YAML configuration file, resolving webhooks kept in the environment or
+// in secret files. It warns when the file, which may hold webhooks itself, is world-readable.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+
+	warnWorldReadable(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	for name, destination := range config.Destinations {
+		if destination.Webhook, err = resolveSecret(destination.Webhook, destination.WebhookEnv, destination.WebhookFile); err != nil {
+			return config, fmt.Errorf("destination %q: %w", name, err)
+		}
+		if destination.Webhook == "" {
+			return config, fmt.Errorf("destination %q has no webhook: %s", name, missingWebhook(destination))
+		}
+		config.Destinations[name] = destination
+	}
+
+	return config, config.validate()
+}
+
+// checkDefault function makes sure the default destination has a webhook wherever events can reach it. Config files
+// are validated before -webhook is known, so until then "default" counts as defined; without -webhook it only is when
+// the config defines it. Events reach it through a route naming it, or when no route matches them and the config
+// has no default of its own and no route matching everything.
+func (c Config) checkDefault(webhook bool) error {
+	if _, ok := c.Destinations[defaultDestination]; ok || webhook || (len(c.Destinations) == 0 && len(c.Routes) == 0) {
+		return nil
+	}
+
+	for i, route := range c.Routes {
+		if route.Destination == defaultDestination || route.Fallback == defaultDestination {
+			return fmt.Errorf("route %d (%s) uses destination %q, which needs -webhook or a destination of that name", i+1, route.Name, defaultDestination)
+		}
+	}
+
+	if c.Default != "" && c.Default != defaultDestination {
+		return nil
+	}
+	for _, route := range c.Routes {
+		if route.Filter.catchAll() {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("events no route matches go to destination %q, which needs -webhook, a destination of that name, a default, or a route without filters", defaultDestination)
+}
+
+// catchAll function reports whether the filter matches every event.
+func (r Filter) catchAll() bool {
+	return len(r.Types) == 0 && len(r.Programs) == 0 && len(r.Severities) == 0 && len(r.Domains) == 0
+}
+
+// missingWebhook function explains why a destination resolved to no webhook.
+func missingWebhook(destination Destination) string {
+	var reasons []string
+	if destination.WebhookEnv != "" {
+		reasons = append(reasons, fmt.Sprintf("environment variable %s is unset or empty", destination.WebhookEnv))
+	}
+	if destination.WebhookFile != "" {
+		reasons = append(reasons, fmt.Sprintf("file %s is empty", destination.WebhookFile))
+	}
+	if len(reasons) == 0 {
+		return "set webhook, webhook_env or webhook_file"
+	}
+
+	return strings.Join(reasons, " and ")
+}
+
+// validate function checks that every route points at a defined destination.
+func (c Config) validate() error {
+	known := func(name string) bool {
+		_, ok := c.Destinations[name]
+		return ok || name == defaultDestination
+	}
+
+	for name, destination := range c.Destinations {
+		if destination.QuietHours != nil {
+			if err := destination.QuietHours.parse(); err != nil {
+				return fmt.Errorf("destination %q quiet hours: %w", name, err)
+			}
+		}
+	}
+
+	if c.Default != "" && !known(c.Default) {
+		return fmt.Errorf("default destination %q is not defined", c.Default)
+	}
+
+	for i, route := range c.Routes {
+		if route.Destination == "" {
+			return fmt.Errorf("route %d (%s) has no destination", i+1, route.Name)
+		}
+		if !known(route.Destination) {
+			return fmt.Errorf("route %d (%s) uses undefined destination %q", i+1, route.Name, route.Destination)
+		}
+		if route.Fallback != "" && !known(route.Fallback) {
+			return fmt.Errorf("route %d (%s) uses undefined fallback %q", i+1, route.Name, route.Fallback)
+		}
+	}
+
+	for i, rule := range c.Mentions {
+		if len(rule.Roles) == 0 && len(rule.Users) == 0 {
+			return fmt.Errorf("mention %d (%s) has no roles or users", i+1, rule.Name)
+		}
+	}
+
+	for i, hook := range c.Hooks {
+		if len(hook.Command) == 0 {
+			return fmt.Errorf("hook %d (%s) has no command", i+1, hook.Name)
+		}
+		if hook.Per != "" && hook.Per != "event" && hook.Per != "run" {
+			return fmt.Errorf("hook %d (%s) has unknown per %q, use event or run", i+1, hook.Name, hook.Per)
+		}
+	}
+
+	return nil
+}
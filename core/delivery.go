@@ -0,0 +1,231 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+const (
+	deliveryTimeout = 30 * time.Second
+	deliveryRetries = 5
+	deliveryBackoff = time.Second
+	deliveryMaxWait = 5 * time.Minute
+)
+
+// errPermanent marks a failure that retrying will not fix.
+var errPermanent = errors.New("permanent failure")
+
+// redactError function drops the URL from the errors of the HTTP client. For a webhook it holds the token, which must
+// never reach the logs; the cause, such as a refused connection or a timeout, is kept.
+func redactError(err error) error {
+	var urlErr *neturl.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+
+	return fmt.Errorf("%s request: %w", urlErr.Op, urlErr.Err)
+}
+
+// statusError is a 4xx answer; it is permanent, retrying the same request will not help.
+type statusError struct {
+	Status int
+	Body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: status %d: %s", errPermanent, e.Status, e.Body)
+}
+
+func (e *statusError) Is(target error) bool {
+	return target == errPermanent
+}
+
+// Delivery posts payloads to Discord, honouring rate-limit headers and retrying server errors.
+type Delivery struct {
+	mutex   sync.Mutex
+	resetAt map[string]time.Time
+}
+
+// NewDelivery function creates and returns a new instance of the Delivery struct.
+func NewDelivery() *Delivery {
+	return &Delivery{
+		resetAt: make(map[string]time.Time),
+	}
+}
+
+// Attachment is a file uploaded alongside a webhook message.
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+// Send function posts a payload and blocks until Discord accepts it, retries are exhausted or the failure is permanent.
+// It returns Discord's response body, which holds the created message when the URL asks for ?wait=true.
+func (d *Delivery) Send(url string, payload model.DiscordMessage, files ...Attachment) ([]byte, error) {
+	return d.Do("POST", url, payload, files...)
+}
+
+// Do function performs a webhook request with the given method, with the same rate limiting and retries as Send.
+func (d *Delivery) Do(method string, url string, payload model.DiscordMessage, files ...Attachment) ([]byte, error) {
+	body, contentType, err := encodePayload(payload, files)
+	if err != nil {
+		return nil, fmt.Errorf("%w: encode payload: %s", errPermanent, err)
+	}
+
+	var lastErr error
+
+	for attempt := 0; attempt <= deliveryRetries; attempt++ {
+		d.waitBucket(url)
+
+		wait, response, err := d.request(method, url, body, contentType)
+		if err == nil {
+			return response, nil
+		}
+		if errors.Is(err, errPermanent) {
+			return nil, err
+		}
+		lastErr = err
+
+		if wait <= 0 {
+			wait = backoff(deliveryBackoff, attempt, deliveryMaxWait)
+		}
+		if wait > deliveryMaxWait {
+			wait = deliveryMaxWait
+		}
+		time.Sleep(wait)
+	}
+
+	return nil, fmt.Errorf("giving up after %d attempts: %w", deliveryRetries+1, lastErr)
+}
+
+// request function performs a single webhook request and returns how long to wait before retrying, if Discord said so.
+func (d *Delivery) request(method string, url string, body []byte, contentType string) (time.Duration, []byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %s", errPermanent, redactError(err))
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, nil, redactError(err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	d.updateBucket(url, resp.Header)
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return retryAfter(resp.Header, data), nil, fmt.Errorf("rate limited (%d)", resp.StatusCode)
+	case resp.StatusCode >= 500:
+		return 0, nil, fmt.Errorf("server error (%d)", resp.StatusCode)
+	case resp.StatusCode >= 400:
+		return 0, nil, &statusError{Status: resp.StatusCode, Body: string(bytes.TrimSpace(data))}
+	}
+
+	return 0, data, nil
+}
+
+// encodePayload function builds the request body: plain JSON, or multipart form data when files are attached.
+func encodePayload(payload model.DiscordMessage, files []Attachment) ([]byte, string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(files) == 0 {
+		return data, "application/json", nil
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	if err := writer.WriteField("payload_json", string(data)); err != nil {
+		return nil, "", err
+	}
+
+	for i, file := range files {
+		part, err := writer.CreateFormFile(fmt.Sprintf("files[%d]", i), file.Name)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(file.Data); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return body.Bytes(), writer.FormDataContentType(), nil
+}
+
+// waitBucket function sleeps until the webhook's rate-limit bucket has room again.
+func (d *Delivery) waitBucket(url string) {
+	d.mutex.Lock()
+	reset := d.resetAt[bucketKey(url)]
+	d.mutex.Unlock()
+
+	if wait := time.Until(reset); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// updateBucket function records when the webhook's bucket resets once Discord reports it as exhausted.
+func (d *Delivery) updateBucket(url string, header http.Header) {
+	if header.Get("X-RateLimit-Remaining") != "0" {
+		return
+	}
+
+	resetAfter, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64)
+	if err != nil {
+		return
+	}
+
+	d.mutex.Lock()
+	d.resetAt[bucketKey(url)] = time.Now().Add(time.Duration(resetAfter * float64(time.Second)))
+	d.mutex.Unlock()
+}
+
+// bucketKey function strips the query from a webhook URL, since Discord limits per webhook rather than per thread.
+func bucketKey(url string) string {
+	if i := strings.IndexByte(url, '?'); i >= 0 {
+		url = url[:i]
+	}
+
+	return url
+}
+
+// retryAfter function reads the wait time of a 429 response from its header or JSON body.
+func retryAfter(header http.Header, body []byte) time.Duration {
+	if seconds, err := strconv.ParseFloat(header.Get("Retry-After"), 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+
+	var limited struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if err := json.Unmarshal(body, &limited); err == nil && limited.RetryAfter > 0 {
+		return time.Duration(limited.RetryAfter * float64(time.Second))
+	}
+
+	return deliveryBackoff
+}
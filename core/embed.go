@@ -0,0 +1,136 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+// Discord truncates or rejects embed fields above these limits.
+const (
+	maxFieldName  = 256
+	maxFieldValue = 1024
+)
+
+var severityColors = map[string]int{
+	"critical": 0xE74C3C,
+	"high":     0xE67E22,
+	"medium":   0xF1C40F,
+	"low":      0x3498DB,
+	"none":     0x95A5A6,
+}
+
+var eventColors = map[model.EventType]int{
+	model.EventLog:           0xADD8E6,
+	model.EventServiceNew:    0x2ECC71,
+	model.EventServiceStatus: 0xE67E22,
+	model.EventServiceCode:   0x9B59B6,
+	model.EventServiceWords:  0x95A5A6,
+	model.EventServiceTech:   0x1ABC9C,
+	model.EventServiceTitle:  0x3498DB,
+}
+
+var eventTitles = map[model.EventType]string{
+	model.EventServiceNew:    "💸 New Service Is Up",
+	model.EventServiceStatus: "💸 Change Status Detected",
+	model.EventServiceCode:   "💸 Change Code Detected",
+	model.EventServiceWords:  "💸 Change Word Count Detected",
+	model.EventServiceTech:   "💸 Change Technology Detected",
+	model.EventServiceTitle:  "💸 Change Title Detected",
+}
+
+// embed function turns an event into the Discord embed announcing it.
+func (m *Messager) embed(event model.Event) model.DiscordEmbed {
+	embed := model.DiscordEmbed{
+		Color:     eventColor(event),
+		Timestamp: event.Time.Format(time.RFC3339),
+	}
+
+	switch event.Type {
+	case model.EventLog:
+		embed.Description = event.Message
+		return embed
+	case model.EventScopeNew:
+		embed.Title = "💣 New Scope: " + event.Program
+		embed.Url = event.ProgramURL
+		embed.Fields = []model.DiscordEmbedField{
+			field("Program", event.Program, true),
+			field("Asset", event.Asset, true),
+			field("Type", event.AssetType, true),
+			field("Severity", event.Severity, true),
+			field("Bounty", yesNo(event.Bounty), true),
+		}
+		if event.Instruction != "" {
+			embed.Fields = append(embed.Fields, field("Instructions", event.Instruction, false))
+		}
+	case model.EventServiceNew:
+		embed.Title = eventTitles[event.Type]
+		embed.Url = event.Asset
+		embed.Fields = []model.DiscordEmbedField{
+			field("Service", event.Asset, false),
+			field("Title", event.Service.Title, true),
+			field("Status", yesNo(event.Service.Status), true),
+			field("Code", strings.Join(event.Service.Code, " → "), true),
+			field("Words", strconv.Itoa(event.Service.Words), true),
+			field("Technology", strings.Join(event.Service.Technology, ", "), false),
+		}
+	default:
+		embed.Title = eventTitles[event.Type]
+		embed.Url = event.Asset
+		embed.Fields = []model.DiscordEmbedField{
+			field("Service", event.Asset, false),
+			field("Old", event.Old, true),
+			field("New", event.New, true),
+		}
+	}
+
+	embed.Footer = &model.DiscordEmbedFooter{Text: fmt.Sprintf("%s • run %s", event.Source, event.RunID)}
+
+	return embed
+}
+
+// eventColor function picks the embed colour from the severity of scope events and from the type of everything else.
+func eventColor(event model.Event) int {
+	if event.Type == model.EventScopeNew {
+		if color, ok := severityColors[strings.ToLower(event.Severity)]; ok {
+			return color
+		}
+		return severityColors["none"]
+	}
+
+	if event.Type == model.EventServiceStatus && event.New == "false" {
+		return severityColors["critical"]
+	}
+
+	return eventColors[event.Type]
+}
+
+// field function builds an embed field, substituting a dash for empty values and cutting values Discord would reject.
+func field(name string, value string, inline bool) model.DiscordEmbedField {
+	if value == "" {
+		value = "-"
+	}
+
+	return model.DiscordEmbedField{Name: truncate(name, maxFieldName), Value: truncate(value, maxFieldValue), Inline: inline}
+}
+
+// truncate function shortens text to at most limit characters, marking the cut with an ellipsis.
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+
+	return string(runes[:limit-1]) + "…"
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+
+	return "no"
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	fetchTimeout    = 5 * time.Minute
+	fetchRetries    = 4
+	fetchBackoff    = 2 * time.Second
+	fetchMaxBackoff = time.Minute
+)
+
+// httpClient is shared by every outbound request. The transport bounds connecting, the TLS handshake and the wait
+// for response headers; each request bounds its whole duration with a context.
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 15 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   15 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   4,
+	},
+}
+
+// errNotModified is returned when the server confirms the document is unchanged since the given validator.
+var errNotModified = errors.New("not modified")
+
+// Fetcher downloads documents with the shared client, retrying network errors, server errors and rate limits with
+// exponential backoff.
+type Fetcher struct {
+	Timeout time.Duration
+	Retries int
+}
+
+// NewFetcher function creates and returns a new instance of the Fetcher struct.
+func NewFetcher() *Fetcher {
+	return &Fetcher{Timeout: fetchTimeout, Retries: fetchRetries}
+}
+
+// Download function streams url into file, so the body is never held in memory. Anything but a 200 answer with one
+// of the accepted content types is an error; client errors are not retried. When the document still has the given
+// ETag, the server answers 304 and errNotModified is returned. It returns the ETag of the downloaded version. The
+// file is emptied before every attempt and is left positioned at its end.
+func (f *Fetcher) Download(url string, etag string, file *os.File, accept ...string) (string, error) {
+	return f.get(url, etag, accept, func() (io.Writer, error) {
+		if err := file.Truncate(0); err != nil {
+			return nil, err
+		}
+		_, err := file.Seek(0, io.SeekStart)
+		return file, err
+	})
+}
+
+// get function retries fetch until it succeeds, fails permanently or runs out of attempts. body is called for the
+// writer of every attempt that gets a response to read.
+func (f *Fetcher) get(url string, etag string, accept []string, body func() (io.Writer, error)) (string, error) {
+	var lastErr error
+	var retryAfter time.Duration
+
+	for attempt := 0; attempt <= f.Retries; attempt++ {
+		if attempt > 0 {
+			wait := backoff(fetchBackoff, attempt-1, fetchMaxBackoff)
+			if retryAfter > wait {
+				wait = retryAfter
+			}
+			fmt.Printf("\033[33m[!] Fetch Failed: %s, Retrying In %s\033[0m\n", lastErr, wait.Round(time.Second))
+			time.Sleep(wait)
+		}
+
+		validator, wait, err := f.fetch(url, etag, accept, body)
+		if err == nil {
+			return validator, nil
+		}
+		if errors.Is(err, errPermanent) || errors.Is(err, errNotModified) {
+			return "", err
+		}
+		lastErr, retryAfter = err, wait
+	}
+
+	return "", fmt.Errorf("giving up after %d attempts: %w", f.Retries+1, lastErr)
+}
+
+// fetch function performs a single download into the writer body returns, and returns the ETag of the document and
+// how long to wait before retrying if the server said so.
+func (f *Fetcher) fetch(url string, etag string, accept []string, body func() (io.Writer, error)) (string, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %s", errPermanent, err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && etag != "":
+		return "", 0, errNotModified
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return "", retryAfter(resp.Header, nil), fmt.Errorf("rate limited (%d)", resp.StatusCode)
+	case resp.StatusCode >= 500:
+		return "", 0, fmt.Errorf("server error (%d)", resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", 0, &statusError{Status: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+
+	if err := checkContentType(resp.Header.Get("Content-Type"), accept); err != nil {
+		return "", 0, err
+	}
+
+	writer, err := body()
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %s", errPermanent, err)
+	}
+	if _, err := io.Copy(writer, resp.Body); err != nil {
+		return "", 0, fmt.Errorf("read body: %w", err)
+	}
+
+	return resp.Header.Get("ETag"), 0, nil
+}
+
+// checkContentType function rejects a response whose media type is not one of the accepted ones, such as an HTML
+// error page served with a 200 status. Any type passes when none are accepted explicitly.
+func checkContentType(header string, accept []string) error {
+	if len(accept) == 0 {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return fmt.Errorf("unreadable content type %q", header)
+	}
+
+	for _, accepted := range accept {
+		if strings.EqualFold(mediaType, accepted) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unexpected content type %s, want %s", mediaType, strings.Join(accept, " or "))
+}
+
+// backoff function returns the wait before the retry following failed attempt n, counted from 0: base doubled for
+// each attempt and capped at max, then lowered by a random part of up to half so clients that failed together do
+// not all retry at the same moment.
+func backoff(base time.Duration, attempt int, max time.Duration) time.Duration {
+	wait := max
+	if attempt < 30 && base<<attempt < max {
+		wait = base << attempt
+	}
+
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
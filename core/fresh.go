@@ -3,16 +3,12 @@ package core
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/NImaism/ScopeDetective/model"
@@ -22,17 +18,20 @@ import (
 
 type Fresh struct {
 	NotificationSystem *Messager
+	Store              Store
 	Options            *Options
 }
 
-// NewFresh function Creates a new Fresh instance with the specified notification system and options.
-func NewFresh(NotificationSystem *Messager, Option Options) *Fresh {
+// NewFresh function Creates a new Fresh instance with the specified notification system, store and options.
+func NewFresh(NotificationSystem *Messager, Store Store, Option Options) *Fresh {
 	return &Fresh{
 		NotificationSystem: NotificationSystem,
+		Store:              Store,
 		Options:            &Option,
 	}
 }
 
+// Run function runs Start in a loop, every Delay minutes. A run that fails is logged and skipped.
 func (F *Fresh) Run() {
 	ticker := time.NewTicker(time.Duration(F.Options.Delay) * time.Minute)
 	defer ticker.Stop()
@@ -40,21 +39,29 @@ func (F *Fresh) Run() {
 	for {
 		select {
 		case <-ticker.C:
-			F.Start()
+			if err := F.Start(); err != nil {
+				fmt.Printf("\033[31m[!] Subdomain Run Skipped: %s\033[0m\n", err)
+				F.NotificationSystem.sendLog(fmt.Sprintf("```yaml\n - ⚠️ Detective Skips A Subdomain Run: %s ```", err))
+			}
 		}
 	}
 }
 
-func (F *Fresh) Start() {
+// Start function enumerates the subdomains of every monitored domain, probes them, and notifies what changed
+// since the last run.
+func (F *Fresh) Start() error {
 	if len(F.Options.WildCards) == 0 {
-		syscall.Exit(0)
+		return errors.New("no domains to monitor, use -d")
 	}
 
 	var wg sync.WaitGroup
 	var allSubs []string
 	var subMutex sync.Mutex
 
-	subFinder := F.GenerateSubRunner()
+	subFinder, err := F.GenerateSubRunner()
+	if err != nil {
+		return err
+	}
 
 	for _, v := range F.Options.WildCards {
 		wg.Add(1)
@@ -76,15 +83,31 @@ func (F *Fresh) Start() {
 	}
 	wg.Wait()
 
-	checkedSubs := F.CheckSub(allSubs)
-	savedSubs := F.OpenData(checkedSubs)
+	checkedSubs, err := F.CheckSub(allSubs)
+	if err != nil {
+		return err
+	}
+
+	savedSubs, err := F.OpenData(checkedSubs)
+	if err != nil {
+		return err
+	}
 
-	F.CompareData(savedSubs, checkedSubs)
+	runID := newRunID()
+	err = F.CompareData(runID, savedSubs, checkedSubs)
+	F.NotificationSystem.EndRun(runID)
 
-	F.SaveData(checkedSubs)
+	// A service whose alert was not queued must not be saved as seen.
+	if err != nil {
+		return err
+	}
+
+	return F.SaveData(Run{ID: runID, Source: "Fresh", Time: time.Now()}, allSubs, checkedSubs)
 }
 
-func (F *Fresh) CompareData(Saved []model.Sub, New []model.Sub) {
+// CompareData function queues an event for every new service and every changed property of a known one. It stops at
+// the first event that cannot be queued.
+func (F *Fresh) CompareData(runID string, Saved []model.Sub, New []model.Sub) error {
 	savedMap := make(map[string]model.Sub)
 	newMap := make(map[string]model.Sub)
 
@@ -99,51 +122,84 @@ func (F *Fresh) CompareData(Saved []model.Sub, New []model.Sub) {
 	for url, data := range newMap {
 		saved, ok := savedMap[url]
 		if !ok {
-			F.NotificationSystem.sendSubMessage(fmt.Sprintf("```yaml\n - 💸 New Service Is Up \n- Title: %s \n- Status: %t \n- Technology: %s\n- Code: %d  ```", newMap[url].Title, newMap[url].Status, newMap[url].Technology, newMap[url].Code), newMap[url].URL)
+			service := data
+			if err := F.NotificationSystem.Notify(model.Event{Type: model.EventServiceNew, Source: "Fresh", RunID: runID, Domain: F.domainOf(url), Asset: url, Service: &service}); err != nil {
+				return err
+			}
 			continue
 		}
 
 		if data.Status != saved.Status {
-			F.NotificationSystem.sendSubMessage(fmt.Sprintf("```yaml\n - 💸 Change Status Detected \n- oldStatus: %t \n- newStatus: %t ```", savedMap[url].Status, newMap[url].Status), newMap[url].URL)
+			if err := F.notifyChange(runID, model.EventServiceStatus, data, strconv.FormatBool(saved.Status), strconv.FormatBool(data.Status)); err != nil {
+				return err
+			}
 		}
 
 		if HaveDifferent(saved.Code, data.Code) {
-			F.NotificationSystem.sendSubMessage(fmt.Sprintf("```yaml\n - 💸 Change Code Detected \n- oldCode: %d \n- newCode: %d ```", savedMap[url].Code, newMap[url].Code), newMap[url].URL)
+			if err := F.notifyChange(runID, model.EventServiceCode, data, strings.Join(saved.Code, " → "), strings.Join(data.Code, " → ")); err != nil {
+				return err
+			}
 		}
 
 		if data.Words != saved.Words {
-			F.NotificationSystem.sendSubMessage(fmt.Sprintf("```yaml\n - 💸 Change Word Count Detected \n- oldCount: %d \n- newCount: %d ```", savedMap[url].Words, newMap[url].Words), newMap[url].URL)
+			if err := F.notifyChange(runID, model.EventServiceWords, data, strconv.Itoa(saved.Words), strconv.Itoa(data.Words)); err != nil {
+				return err
+			}
 		}
 
 		if HaveDifferent(saved.Technology, data.Technology) {
-			F.NotificationSystem.sendSubMessage(fmt.Sprintf("```yaml\n - 💸 Change Technology Detected \n- oldTechs: %s \n- newTechs: %s ```", savedMap[url].Technology, newMap[url].Technology), newMap[url].URL)
+			if err := F.notifyChange(runID, model.EventServiceTech, data, strings.Join(saved.Technology, ", "), strings.Join(data.Technology, ", ")); err != nil {
+				return err
+			}
 		}
 
 		if data.Title != saved.Title {
 			if data.Title == "Just a moment..." || saved.Title == "Just a moment..." {
 				continue
 			}
-			F.NotificationSystem.sendSubMessage(fmt.Sprintf("```yaml\n - 💸 Change Title Detected \n- oldTitle: %s \n- newTitle: %s ```", savedMap[url].Title, newMap[url].Title), newMap[url].URL)
+			if err := F.notifyChange(runID, model.EventServiceTitle, data, saved.Title, data.Title); err != nil {
+				return err
+			}
 		}
 
 	}
 
+	return nil
+}
+
+// notifyChange function queues an event describing a changed property of a service.
+func (F *Fresh) notifyChange(runID string, kind model.EventType, service model.Sub, old string, new string) error {
+	return F.NotificationSystem.Notify(model.Event{Type: kind, Source: "Fresh", RunID: runID, Domain: F.domainOf(service.URL), Asset: service.URL, Service: &service, Old: old, New: new})
 }
 
-func (F *Fresh) CheckSub(subs []string) []model.Sub {
+// domainOf function returns the monitored domain a service URL belongs to.
+func (F *Fresh) domainOf(service string) string {
+	host := hostOf(service)
+
+	for _, domain := range F.Options.WildCards {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return domain
+		}
+	}
+
+	return host
+}
+
+// CheckSub function probes the subdomains with httpx and returns what it found on each.
+func (F *Fresh) CheckSub(subs []string) ([]model.Sub, error) {
 	var result []model.Sub
 	options := F.GenerateHttpxRunner(subs, &result)
 
 	httpxRunner, err := httpx.New(options)
 	if err != nil {
-		fmt.Printf("\033[31m[!] Feild To Run HTTPX \033[0m\n")
+		return nil, fmt.Errorf("create httpx runner: %w", err)
 	}
 
 	defer httpxRunner.Close()
 
 	httpxRunner.RunEnumeration()
 
-	return result
+	return result, nil
 }
 
 func (F *Fresh) GetSubs(domain string, subFinder *subfinder.Runner) []string {
@@ -156,33 +212,16 @@ func (F *Fresh) GetSubs(domain string, subFinder *subfinder.Runner) []string {
 	return strings.Split(output.String(), "\n")
 }
 
-// SaveData function saves data to a JSON file for future retrieval.
-func (F *Fresh) SaveData(Subs []model.Sub) {
-	jsonData, err := json.Marshal(Subs)
-	if err != nil {
-		fmt.Println("\033[31m[!] Marshal Data Error\033[0m")
-		syscall.Exit(0)
+// SaveData function records the subdomains and services of the run in the store for future retrieval.
+func (F *Fresh) SaveData(run Run, Subdomains []string, Subs []model.Sub) error {
+	if err := F.Store.SaveServices(run, Subdomains, Subs); err != nil {
+		return fmt.Errorf("save services: %w", err)
 	}
 
-	if err := os.MkdirAll("data", 0755); err != nil {
-		panic(err)
-	}
-
-	filePath := filepath.Join("data", "Subs.json")
-	file, err := os.Create(filePath)
-	if err != nil {
-		fmt.Println("\033[31m[!] Save Pulled File Error\033[0m")
-		syscall.Exit(0)
-	}
-	defer file.Close()
-
-	if _, err := file.Write(jsonData); err != nil {
-		fmt.Println("\033[31m[!] Save Pulled File Error\033[0m")
-		syscall.Exit(0)
-	}
+	return nil
 }
 
-func (F *Fresh) GenerateSubRunner() *subfinder.Runner {
+func (F *Fresh) GenerateSubRunner() (*subfinder.Runner, error) {
 	subFinderRunner, err := subfinder.NewRunner(&subfinder.Options{
 		Silent:             true,
 		Threads:            10,
@@ -191,10 +230,10 @@ func (F *Fresh) GenerateSubRunner() *subfinder.Runner {
 	})
 
 	if err != nil {
-		fmt.Println("\033[31m[!] Can't Create SubFinder Instance\033[0m")
+		return nil, fmt.Errorf("create subfinder runner: %w", err)
 	}
 
-	return subFinderRunner
+	return subFinderRunner, nil
 }
 
 func (F *Fresh) GenerateHttpxRunner(sub []string, output *[]model.Sub) *httpx.Options {
@@ -232,84 +271,18 @@ func (F *Fresh) GenerateHttpxRunner(sub []string, output *[]model.Sub) *httpx.Op
 	}
 }
 
-// OpenData function opens or creates a JSON file to store and retrieve data.
-func (F *Fresh) OpenData(Data []model.Sub) []model.Sub {
-	if _, err := os.Stat("data/Subs.json"); os.IsNotExist(err) {
-		jsonData, err := json.Marshal(Data)
-		if err != nil {
-			fmt.Println("\033[31m[!] Marshal Data Error\033[0m")
-			syscall.Exit(0)
-		}
-
-		if err := os.MkdirAll("data", 0755); err != nil {
-			fmt.Println("\033[31m[!] Create Directory File Error\033[0m")
-			syscall.Exit(0)
-		}
-
-		filePath := filepath.Join("data", "Subs.json")
-		file, err := os.Create(filePath)
-		if err != nil {
-			fmt.Println("\033[31m[!] Save Pulled File Error\033[0m")
-			syscall.Exit(0)
-
-		}
-		defer file.Close()
-
-		if _, err := file.Write(jsonData); err != nil {
-			fmt.Println("\033[31m[!] Write Pulled File Error\033[0m")
-			syscall.Exit(0)
-		}
-
-		return Data
-	} else {
-		file, err := os.OpenFile("data/Subs.json", os.O_RDWR, 0644)
-		if err != nil {
-			fmt.Println("\033[31m[!] Open Pulled File Error\033[0m")
-			syscall.Exit(0)
-		}
-		defer file.Close()
-
-		data, err := ioutil.ReadAll(file)
-		if err != nil {
-			fmt.Println("\033[31m[!] Error reading file\033[0m")
-			syscall.Exit(0)
-		}
-
-		var SavedData []model.Sub
-		err = json.Unmarshal(data, &SavedData)
-		if err != nil {
-			fmt.Println("\033[31m[!] Error unmarshalling JSON data\033[0m")
-			fmt.Println("\033[34m[+] Working on the problem\033[0m")
-
-			err = file.Truncate(0)
-			if err != nil {
-				fmt.Println("\u001B[31m[!] Error deleting file content\u001B[0m")
-				syscall.Exit(0)
-			}
-
-			jsonData, err := json.Marshal(Data)
-			if err != nil {
-				fmt.Println("\033[31m[!] Marshal Data Error\033[0m")
-				syscall.Exit(0)
-			}
-
-			_, err = file.Write(jsonData)
-			if err != nil {
-				fmt.Println("\033[31m[!] Write Pulled File Error\033[0m")
-				syscall.Exit(0)
-			}
-
-			fmt.Println("\033[34m[+] Problem has been solved\033[0m")
-
-			return Data
-		} else {
-			if len(SavedData) == 0 {
-				syscall.Exit(0)
-			}
-			fmt.Println("\033[33m[+] " + "Subs Count: " + strconv.Itoa(len(SavedData)) + "\033[0m")
-
-			return SavedData
-		}
+// OpenData function returns the services recorded by the last run, or Data when nothing was recorded yet.
+func (F *Fresh) OpenData(Data []model.Sub) ([]model.Sub, error) {
+	SavedData, err := F.Store.Services()
+	if err != nil {
+		return nil, fmt.Errorf("open saved services: %w", err)
+	}
 
+	if len(SavedData) == 0 {
+		fmt.Println("\033[34m[+] No Saved Services, Using This Run As Baseline\033[0m")
+		return Data, nil
 	}
+
+	fmt.Println("\033[33m[+] " + "Subs Count: " + strconv.Itoa(len(SavedData)) + "\033[0m")
+	return SavedData, nil
 }
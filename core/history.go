@@ -0,0 +1,449 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// HistoryFormats lists the formats the history command prints in.
+var HistoryFormats = []string{"table", "json"}
+
+// ScopeItem is an entry of a program's scope as it was at some point.
+type ScopeItem struct {
+	Program   string    `json:"program"`
+	Asset     string    `json:"asset"`
+	AssetType string    `json:"asset_type"`
+	Severity  string    `json:"severity"`
+	Bounty    bool      `json:"bounty"`
+	Eligible  bool      `json:"eligible"`
+	Since     time.Time `json:"since"`
+}
+
+// Change is one difference between two consecutive runs in the history of a scope item.
+type Change struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Program string    `json:"program"`
+	Asset   string    `json:"asset"`
+	Details string    `json:"details,omitempty"`
+}
+
+// Appearance is a stretch of consecutive runs an asset was seen in. GoneSince is the first run that no longer saw
+// it, and is empty while it is still there.
+type Appearance struct {
+	Kind      string     `json:"kind"`
+	Program   string     `json:"program,omitempty"`
+	Asset     string     `json:"asset"`
+	FirstSeen time.Time  `json:"first_seen"`
+	LastSeen  time.Time  `json:"last_seen"`
+	GoneSince *time.Time `json:"gone_since,omitempty"`
+}
+
+// span is one row of an observation table: an item seen unchanged from first to last.
+type span struct {
+	key         string
+	program     string
+	asset       string
+	values      []string
+	first, last int64
+}
+
+// runTimes is the sorted list of the times runs of one kind took place.
+type runTimes []int64
+
+// History function answers the history command: the scope of a program at a date, the changes to a program over
+// the last days, or the appearances of an asset, printed as a table or JSON.
+func History(o *Options) error {
+	path := filepath.Join(o.DataDir, databaseName)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("no history in %s, run the monitor with -storage sqlite first", o.DataDir)
+	}
+
+	store, err := OpenSQLiteStoreReadOnly(path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var result any
+	switch {
+	case o.HistoryAsset != "":
+		result, err = store.AssetHistory(o.HistoryAsset)
+	case o.HistoryProgram != "" && o.HistoryAt != "":
+		var at time.Time
+		if at, err = parseHistoryTime(o.HistoryAt); err == nil {
+			result, err = store.ScopeAt(o.HistoryProgram, at)
+		}
+	case o.HistoryProgram != "":
+		result, err = store.ScopeChanges(o.HistoryProgram, time.Now().AddDate(0, 0, -o.HistoryDays))
+	default:
+		return errors.New("history needs -program or -asset")
+	}
+	if err != nil {
+		return err
+	}
+
+	if o.HistoryFormat == "json" {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(o.stdout, string(data))
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(o.stdout, 0, 0, 2, ' ', 0)
+	switch rows := result.(type) {
+	case []ScopeItem:
+		fmt.Fprintln(writer, "PROGRAM\tASSET\tTYPE\tSEVERITY\tBOUNTY\tELIGIBLE\tSINCE")
+		for _, item := range rows {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", item.Program, item.Asset, item.AssetType, item.Severity, yesNo(item.Bounty), yesNo(item.Eligible), historyTime(item.Since))
+		}
+	case []Change:
+		fmt.Fprintln(writer, "TIME\tCHANGE\tPROGRAM\tASSET\tDETAILS")
+		for _, change := range rows {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", historyTime(change.Time), change.Kind, change.Program, change.Asset, change.Details)
+		}
+	case []Appearance:
+		fmt.Fprintln(writer, "KIND\tPROGRAM\tASSET\tFIRST SEEN\tLAST SEEN\tGONE SINCE")
+		for _, appearance := range rows {
+			gone := "-"
+			if appearance.GoneSince != nil {
+				gone = historyTime(*appearance.GoneSince)
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", appearance.Kind, appearance.Program, appearance.Asset, historyTime(appearance.FirstSeen), historyTime(appearance.LastSeen), gone)
+		}
+	}
+
+	return writer.Flush()
+}
+
+// ScopeAt function returns the scope of a program as it was after the last scope run at or before at.
+func (s *SQLiteStore) ScopeAt(program string, at time.Time) ([]ScopeItem, error) {
+	urls, err := s.programURLs(program)
+	if err != nil {
+		return nil, err
+	}
+
+	var run sql.NullInt64
+	if err := s.db.QueryRow("SELECT MAX(time) FROM runs WHERE kind = ? AND time <= ?", runScopes, at.Unix()).Scan(&run); err != nil {
+		return nil, err
+	}
+	if !run.Valid {
+		return nil, fmt.Errorf("no scope run recorded before %s", historyTime(at))
+	}
+
+	spans, err := s.scopeSpans("program_url IN ("+placeholders(len(urls))+")", urls...)
+	if err != nil {
+		return nil, err
+	}
+
+	runs, err := s.runTimes(runScopes)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []ScopeItem{}
+	for _, group := range groupSpans(spans) {
+		for i, current := range group {
+			if current.first > run.Int64 || current.last < run.Int64 {
+				continue
+			}
+
+			// Since is the start of the appearance, not of the span: a change in severity does not reset it.
+			start := i
+			for start > 0 && runs.continues(group[start-1], group[start]) {
+				start--
+			}
+			items = append(items, ScopeItem{
+				Program:   current.program,
+				Asset:     current.asset,
+				AssetType: current.values[0],
+				Severity:  current.values[1],
+				Bounty:    current.values[2] == "1",
+				Eligible:  current.values[3] == "1",
+				Since:     unixTime(group[start].first),
+			})
+		}
+	}
+
+	return items, nil
+}
+
+// ScopeChanges function returns the scope items of a program that were added, changed or removed since the given
+// time, oldest first.
+func (s *SQLiteStore) ScopeChanges(program string, since time.Time) ([]Change, error) {
+	urls, err := s.programURLs(program)
+	if err != nil {
+		return nil, err
+	}
+
+	spans, err := s.scopeSpans("program_url IN ("+placeholders(len(urls))+")", urls...)
+	if err != nil {
+		return nil, err
+	}
+
+	runs, err := s.runTimes(runScopes)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	for _, group := range groupSpans(spans) {
+		for i, current := range group {
+			change := Change{Time: unixTime(current.first), Kind: "added", Program: current.program, Asset: current.asset}
+			if i > 0 && runs.continues(group[i-1], current) {
+				change.Kind, change.Details = "changed", scopeDiff(group[i-1].values, current.values)
+			}
+			changes = append(changes, change)
+
+			if i == len(group)-1 || !runs.continues(current, group[i+1]) {
+				if gone, ok := runs.after(current.last); ok {
+					changes = append(changes, Change{Time: unixTime(gone), Kind: "removed", Program: current.program, Asset: current.asset})
+				}
+			}
+		}
+	}
+
+	kept := changes[:0]
+	for _, change := range changes {
+		if !change.Time.Before(since) {
+			kept = append(kept, change)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].Time.Before(kept[j].Time) })
+
+	return kept, nil
+}
+
+// AssetHistory function returns every stretch of runs an asset was seen in, as a scope item of any program, as a
+// subdomain, or as a service.
+func (s *SQLiteStore) AssetHistory(asset string) ([]Appearance, error) {
+	appearances := []Appearance{}
+
+	scopes, err := s.scopeSpans("lower(asset) = lower(?)", asset)
+	if err != nil {
+		return nil, err
+	}
+	if appearances, err = s.appearances(appearances, "scope", runScopes, scopes); err != nil {
+		return nil, err
+	}
+
+	subdomains, err := s.spans("SELECT host, '', host, first_seen, last_seen FROM subdomains WHERE host = ? ORDER BY first_seen", asset)
+	if err != nil {
+		return nil, err
+	}
+	if appearances, err = s.appearances(appearances, "subdomain", runServices, subdomains); err != nil {
+		return nil, err
+	}
+
+	services, err := s.spans("SELECT url, '', url, first_seen, last_seen FROM services WHERE url IN (?, ?, ?) ORDER BY url, first_seen", asset, "https://"+asset, "http://"+asset)
+	if err != nil {
+		return nil, err
+	}
+	if appearances, err = s.appearances(appearances, "service", runServices, services); err != nil {
+		return nil, err
+	}
+
+	if len(appearances) == 0 {
+		return nil, fmt.Errorf("%s was never seen", asset)
+	}
+
+	return appearances, nil
+}
+
+// appearances function merges the spans of each item into stretches of consecutive runs of the given kind.
+func (s *SQLiteStore) appearances(appearances []Appearance, kind string, run string, spans []span) ([]Appearance, error) {
+	runs, err := s.runTimes(run)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range groupSpans(spans) {
+		for i := 0; i < len(group); i++ {
+			first := group[i]
+			for i+1 < len(group) && runs.continues(group[i], group[i+1]) {
+				i++
+			}
+
+			appearance := Appearance{Kind: kind, Program: first.program, Asset: first.asset, FirstSeen: unixTime(first.first), LastSeen: unixTime(group[i].last)}
+			if gone, ok := runs.after(group[i].last); ok {
+				since := unixTime(gone)
+				appearance.GoneSince = &since
+			}
+			appearances = append(appearances, appearance)
+		}
+	}
+
+	return appearances, nil
+}
+
+// scopeSpans function loads the scope spans matching a condition, each item's spans in order, with the program's
+// latest name.
+func (s *SQLiteStore) scopeSpans(condition string, args ...any) ([]span, error) {
+	return s.spans(`SELECT program_url || ' ' || asset,
+			COALESCE((SELECT name FROM programs p WHERE p.url = scopes.program_url ORDER BY last_seen DESC LIMIT 1), program_url),
+			asset, first_seen, last_seen, asset_type, severity, bounty, eligible, instruction
+		FROM scopes WHERE `+condition+` ORDER BY program_url, asset, first_seen`, args...)
+}
+
+// spans function runs a query returning key, program, asset, first_seen and last_seen, followed by any values.
+func (s *SQLiteStore) spans(query string, args ...any) ([]span, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var spans []span
+	for rows.Next() {
+		var current span
+		current.values = make([]string, len(columns)-5)
+		targets := []any{&current.key, &current.program, &current.asset, &current.first, &current.last}
+		for i := range current.values {
+			targets = append(targets, &current.values[i])
+		}
+
+		if err := rows.Scan(targets...); err != nil {
+			return nil, err
+		}
+		spans = append(spans, current)
+	}
+
+	return spans, rows.Err()
+}
+
+// programURLs function finds the URLs of the programs known by a name, handle or URL.
+func (s *SQLiteStore) programURLs(program string) ([]any, error) {
+	rows, err := s.db.Query("SELECT DISTINCT url FROM programs WHERE lower(name) = lower(?) OR lower(handle) = lower(?) OR url = ?", program, program, program)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []any
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no program %q in the history", program)
+	}
+
+	return urls, nil
+}
+
+// runTimes function lists the times of every run of a kind, oldest first.
+func (s *SQLiteStore) runTimes(kind string) (runTimes, error) {
+	rows, err := s.db.Query("SELECT time FROM runs WHERE kind = ? ORDER BY time", kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs runTimes
+	for rows.Next() {
+		var at int64
+		if err := rows.Scan(&at); err != nil {
+			return nil, err
+		}
+		runs = append(runs, at)
+	}
+
+	return runs, rows.Err()
+}
+
+// continues function reports whether next starts in the run right after previous ended.
+func (r runTimes) continues(previous span, next span) bool {
+	i := sort.Search(len(r), func(i int) bool { return r[i] >= next.first })
+	return i > 0 && r[i-1] == previous.last
+}
+
+// after function returns the first run later than at.
+func (r runTimes) after(at int64) (int64, bool) {
+	i := sort.Search(len(r), func(i int) bool { return r[i] > at })
+	if i == len(r) {
+		return 0, false
+	}
+
+	return r[i], true
+}
+
+// groupSpans function splits spans, sorted by key, into the spans of each item.
+func groupSpans(spans []span) [][]span {
+	var groups [][]span
+	for i, current := range spans {
+		if i == 0 || spans[i-1].key != current.key {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], current)
+	}
+
+	return groups
+}
+
+// scopeDiff function describes what differs between two versions of a scope item.
+func scopeDiff(old []string, new []string) string {
+	names := []string{"type", "severity", "bounty", "eligible", "instruction"}
+
+	var details []string
+	for i, name := range names {
+		switch {
+		case old[i] == new[i]:
+		case name == "instruction":
+			details = append(details, "instruction changed")
+		case name == "bounty" || name == "eligible":
+			details = append(details, fmt.Sprintf("%s: %s → %s", name, yesNo(old[i] == "1"), yesNo(new[i] == "1")))
+		default:
+			details = append(details, fmt.Sprintf("%s: %s → %s", name, old[i], new[i]))
+		}
+	}
+
+	return strings.Join(details, ", ")
+}
+
+// parseHistoryTime function reads a date, meaning its end, or an RFC 3339 time.
+func parseHistoryTime(value string) (time.Time, error) {
+	if at, err := time.Parse("2006-01-02", value); err == nil {
+		return at.Add(24*time.Hour - time.Second), nil
+	}
+
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date (2006-01-02) nor an RFC 3339 time", value)
+	}
+
+	return at, nil
+}
+
+func historyTime(at time.Time) string {
+	return at.UTC().Format("2006-01-02 15:04")
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func unixTime(seconds int64) time.Time {
+	return time.Unix(seconds, 0).UTC()
+}
@@ -0,0 +1,210 @@
+package core
+
+import (
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+func TestRunTimes(t *testing.T) {
+	runs := runTimes{100, 200, 300}
+
+	continues := []struct {
+		name           string
+		previous, next span
+		want           bool
+	}{
+		{name: "next run", previous: span{first: 100, last: 100}, next: span{first: 200, last: 300}, want: true},
+		{name: "gap of one run", previous: span{first: 100, last: 100}, next: span{first: 300, last: 300}},
+		{name: "first run", previous: span{first: 100, last: 100}, next: span{first: 100, last: 100}},
+		{name: "unknown run", previous: span{first: 100, last: 150}, next: span{first: 200, last: 200}},
+	}
+	for _, c := range continues {
+		t.Run("continues "+c.name, func(t *testing.T) {
+			if got := runs.continues(c.previous, c.next); got != c.want {
+				t.Fatalf("continues = %v, want %v", got, c.want)
+			}
+		})
+	}
+
+	after := []struct {
+		at     int64
+		want   int64
+		wantOK bool
+	}{
+		{at: 50, want: 100, wantOK: true},
+		{at: 100, want: 200, wantOK: true},
+		{at: 150, want: 200, wantOK: true},
+		{at: 300},
+		{at: 400},
+	}
+	for _, c := range after {
+		t.Run("after "+strconv.FormatInt(c.at, 10), func(t *testing.T) {
+			got, ok := runs.after(c.at)
+			if got != c.want || ok != c.wantOK {
+				t.Fatalf("after = %d, %v, want %d, %v", got, ok, c.want, c.wantOK)
+			}
+		})
+	}
+}
+
+// historyStore records five scope runs of one program: a.com is seen at high severity, turns critical, disappears
+// for a run and comes back; b.com appears in the second run and stays. The service runs see a.com as a subdomain
+// twice, then no more, and as a service once.
+func historyStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), databaseName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	a := func(severity string) model.Scope {
+		return model.Scope{AssetIdentifier: "a.com", AssetType: "URL", MaxSeverity: severity, EligibleForSubmission: true, EligibleForBounty: true}
+	}
+	b := model.Scope{AssetIdentifier: "b.com", AssetType: "URL", MaxSeverity: "low", EligibleForSubmission: true}
+
+	scopeRuns := []struct {
+		at    int64
+		items []model.Scope
+	}{
+		{100, []model.Scope{a("high")}},
+		{200, []model.Scope{a("high"), b}},
+		{300, []model.Scope{a("critical"), b}},
+		{400, []model.Scope{b}},
+		{500, []model.Scope{a("critical"), b}},
+	}
+	for _, run := range scopeRuns {
+		program := model.JsonData{URL: "https://hackerone.com/p", Handle: "p", Name: "Program P"}
+		program.Targets.InScope = run.items
+
+		recorder, err := store.RecordScopes(Run{ID: "scopes-" + strconv.FormatInt(run.at, 10), Source: "HackerOne", Time: time.Unix(run.at, 0)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := recorder.Add(program); err != nil {
+			t.Fatal(err)
+		}
+		if err := recorder.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	serviceRuns := []struct {
+		at         int64
+		subdomains []string
+		services   []model.Sub
+	}{
+		{150, []string{"a.com"}, []model.Sub{{URL: "https://a.com", Title: "A", Status: true}}},
+		{250, []string{"a.com"}, nil},
+		{350, nil, nil},
+	}
+	for _, run := range serviceRuns {
+		if err := store.SaveServices(Run{ID: "services-" + strconv.FormatInt(run.at, 10), Source: "Fresh", Time: time.Unix(run.at, 0)}, run.subdomains, run.services); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return store
+}
+
+func TestScopeChanges(t *testing.T) {
+	store := historyStore(t)
+
+	cases := []struct {
+		name  string
+		since int64
+		want  []Change
+	}{
+		{
+			name:  "everything",
+			since: 0,
+			want: []Change{
+				{Time: unixTime(100), Kind: "added", Program: "Program P", Asset: "a.com"},
+				{Time: unixTime(200), Kind: "added", Program: "Program P", Asset: "b.com"},
+				{Time: unixTime(300), Kind: "changed", Program: "Program P", Asset: "a.com", Details: "severity: high → critical"},
+				{Time: unixTime(400), Kind: "removed", Program: "Program P", Asset: "a.com"},
+				{Time: unixTime(500), Kind: "added", Program: "Program P", Asset: "a.com"},
+			},
+		},
+		{
+			name:  "since a run",
+			since: 400,
+			want: []Change{
+				{Time: unixTime(400), Kind: "removed", Program: "Program P", Asset: "a.com"},
+				{Time: unixTime(500), Kind: "added", Program: "Program P", Asset: "a.com"},
+			},
+		},
+		{name: "nothing since", since: 600, want: []Change{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := store.ScopeChanges("p", unixTime(c.since))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("got %+v\nwant %+v", got, c.want)
+			}
+		})
+	}
+
+	if _, err := store.ScopeChanges("unknown", unixTime(0)); err == nil {
+		t.Fatal("unknown program did not fail")
+	}
+}
+
+func TestAssetHistory(t *testing.T) {
+	store := historyStore(t)
+	gone := func(at int64) *time.Time {
+		since := unixTime(at)
+		return &since
+	}
+
+	got, err := store.AssetHistory("a.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Appearance{
+		// The severity change at 300 continues the appearance; the missing run at 400 ends it.
+		{Kind: "scope", Program: "Program P", Asset: "a.com", FirstSeen: unixTime(100), LastSeen: unixTime(300), GoneSince: gone(400)},
+		{Kind: "scope", Program: "Program P", Asset: "a.com", FirstSeen: unixTime(500), LastSeen: unixTime(500)},
+		{Kind: "subdomain", Asset: "a.com", FirstSeen: unixTime(150), LastSeen: unixTime(250), GoneSince: gone(350)},
+		{Kind: "service", Asset: "https://a.com", FirstSeen: unixTime(150), LastSeen: unixTime(150), GoneSince: gone(250)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v\nwant %+v", got, want)
+	}
+
+	if _, err := store.AssetHistory("c.com"); err == nil {
+		t.Fatal("unseen asset did not fail")
+	}
+}
+
+func TestScopeAt(t *testing.T) {
+	store := historyStore(t)
+
+	got, err := store.ScopeAt("Program P", unixTime(350))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ScopeItem{
+		{Program: "Program P", Asset: "a.com", AssetType: "URL", Severity: "critical", Bounty: true, Eligible: true, Since: unixTime(100)},
+		{Program: "Program P", Asset: "b.com", AssetType: "URL", Severity: "low", Eligible: true, Since: unixTime(200)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v\nwant %+v", got, want)
+	}
+
+	if _, err := store.ScopeAt("Program P", unixTime(50)); err == nil {
+		t.Fatal("time before the first run did not fail")
+	}
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+const (
+	hookTimeout     = 5 * time.Minute
+	hookConcurrency = 2
+	hookOutputLimit = 2000
+	// hookWaitDelay bounds the wait for the output of a killed hook to close.
+	hookWaitDelay = 5 * time.Second
+)
+
+// Hook runs a local command for the events matching its filter, either once per event or once per run with all of
+// that run's events.
+type Hook struct {
+	Name    string `yaml:"name"`
+	Filter  `yaml:",inline"`
+	Command []string      `yaml:"command"`
+	Per     string        `yaml:"per"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// HookSink starts the configured hooks in the background, at most Concurrency of them at a time.
+type HookSink struct {
+	hooks []Hook
+	slots chan struct{}
+
+	mutex sync.Mutex
+	runs  map[string]map[int][]model.Event
+}
+
+// NewHookSink function returns a sink running the given hooks.
+func NewHookSink(hooks []Hook, concurrency int) *HookSink {
+	if concurrency <= 0 {
+		concurrency = hookConcurrency
+	}
+
+	return &HookSink{
+		hooks: hooks,
+		slots: make(chan struct{}, concurrency),
+		runs:  make(map[string]map[int][]model.Event),
+	}
+}
+
+// Write function starts the per-event hooks matching the event and keeps it for the per-run hooks.
+func (h *HookSink) Write(event model.Event) error {
+	for i, hook := range h.hooks {
+		if !hook.matches(event) {
+			continue
+		}
+
+		if hook.Per == "run" {
+			h.mutex.Lock()
+			if h.runs[event.RunID] == nil {
+				h.runs[event.RunID] = make(map[int][]model.Event)
+			}
+			h.runs[event.RunID][i] = append(h.runs[event.RunID][i], event)
+			h.mutex.Unlock()
+			continue
+		}
+
+		input, err := json.Marshal(newRecord(event))
+		if err != nil {
+			return err
+		}
+		go h.run(hook, input, eventEnv(event), event.Asset)
+	}
+
+	return nil
+}
+
+// EndRun function starts the per-run hooks that matched events of the finished run.
+func (h *HookSink) EndRun(runID string) {
+	h.mutex.Lock()
+	matched := h.runs[runID]
+	delete(h.runs, runID)
+	h.mutex.Unlock()
+
+	for i, events := range matched {
+		records := make([]record, 0, len(events))
+		for _, event := range events {
+			records = append(records, newRecord(event))
+		}
+
+		input, err := json.Marshal(records)
+		if err != nil {
+			continue
+		}
+
+		env := []string{
+			"SD_RUN_ID=" + runID,
+			"SD_SOURCE=" + events[0].Source,
+			"SD_EVENT_COUNT=" + strconv.Itoa(len(events)),
+		}
+		go h.run(h.hooks[i], input, env, "run "+runID)
+	}
+}
+
+// run function executes a hook with the input on stdin and logs its exit status and output.
+func (h *HookSink) run(hook Hook, input []byte, env []string, subject string) {
+	h.slots <- struct{}{}
+	defer func() { <-h.slots }()
+
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = hookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	output := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, hook.Command[0], hook.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout, cmd.Stderr = output, output
+	cmd.Env = append(os.Environ(), env...)
+	cmd.WaitDelay = hookWaitDelay
+	killGroup(cmd)
+
+	start := time.Now()
+	err := cmd.Run()
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	text := strings.TrimSpace(output.String())
+	if len(text) > hookOutputLimit {
+		text = text[:hookOutputLimit] + "…"
+	}
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		fmt.Printf("\033[31m[!] Hook %s (%s) Timed Out After %s\033[0m\n", hook.Name, subject, timeout)
+	case err != nil:
+		fmt.Printf("\033[31m[!] Hook %s (%s) Failed After %s: %s\033[0m\n", hook.Name, subject, elapsed, err)
+	default:
+		fmt.Printf("\033[32m[+] Hook %s (%s) Exited 0 In %s\033[0m\n", hook.Name, subject, elapsed)
+	}
+	if text != "" {
+		fmt.Println(text)
+	}
+}
+
+// eventEnv function exposes the key fields of an event as environment variables.
+func eventEnv(event model.Event) []string {
+	return []string{
+		"SD_EVENT_ID=" + event.ID,
+		"SD_EVENT_TYPE=" + string(event.Type),
+		"SD_SOURCE=" + event.Source,
+		"SD_RUN_ID=" + event.RunID,
+		"SD_PROGRAM=" + event.Program,
+		"SD_PROGRAM_URL=" + event.ProgramURL,
+		"SD_DOMAIN=" + event.Domain,
+		"SD_ASSET=" + event.Asset,
+		"SD_ASSET_TYPE=" + event.AssetType,
+		"SD_SEVERITY=" + event.Severity,
+		"SD_OLD=" + event.Old,
+		"SD_NEW=" + event.New,
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package core
+
+import "os/exec"
+
+// Elsewhere a timeout kills the hook itself; WaitDelay still stops waiting on children that keep its output open.
+func killGroup(cmd *exec.Cmd) {}
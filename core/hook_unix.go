@@ -0,0 +1,17 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package core
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killGroup function starts the hook in a process group of its own and makes a timeout kill the whole group, so
+// children the hook started do not outlive it.
+func killGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// lockName is the file in the data directory held locked by the running instance.
+const lockName = "ScopeDetective.lock"
+
+// Lock is an exclusive hold on a data directory; it is released when the process exits.
+type Lock struct {
+	file *os.File
+}
+
+// LockDataDir function takes the lock on dir, failing right away if another instance holds it.
+func LockDataDir(dir string) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, lockName)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(file); err != nil {
+		file.Close()
+
+		holder := "another instance"
+		if data, err := os.ReadFile(path); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+			holder += " (pid " + strings.TrimSpace(string(data)) + ")"
+		}
+		return nil, fmt.Errorf("%s is already used by %s: %w", dir, holder, err)
+	}
+
+	_ = file.Truncate(0)
+	_, _ = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+
+	return &Lock{file: file}, nil
+}
+
+// Release function gives up the lock.
+func (l *Lock) Release() error {
+	unlockFile(l.file)
+	return l.file.Close()
+}
+
+// defaultDataDir function returns the per-user state directory, following the XDG base directory spec.
+func defaultDataDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "scopedetective")
+	}
+
+	if runtime.GOOS == "windows" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			return filepath.Join(dir, "ScopeDetective")
+		}
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state", "scopedetective")
+	}
+
+	return "data"
+}
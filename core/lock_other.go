@@ -0,0 +1,12 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package core
+
+import "os"
+
+// Platforms without flock or LockFileEx run unlocked.
+func lockFile(file *os.File) error {
+	return nil
+}
+
+func unlockFile(file *os.File) {}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"strings"
+	"time"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+// mention function fills the message content with the roles and users of every mention rule matching one of the
+// events, skipping rules still in their cooldown, and allows exactly those mentions. It returns the rules it used.
+func (m *Messager) mention(payload *model.DiscordMessage, events []model.Event) []int {
+	allowed := &model.DiscordAllowedMentions{Parse: []string{}}
+	payload.AllowedMentions = allowed
+
+	var used []int
+	var pings []string
+
+	for i, rule := range m.Options.Config.Mentions {
+		if time.Since(m.pinged[i]) < rule.Cooldown || !anyMatch(rule.Filter, events) {
+			continue
+		}
+		used = append(used, i)
+
+		for _, role := range rule.Roles {
+			if !Contains(allowed.Roles, role) {
+				allowed.Roles = append(allowed.Roles, role)
+				pings = append(pings, "<@&"+role+">")
+			}
+		}
+		for _, user := range rule.Users {
+			if !Contains(allowed.Users, user) {
+				allowed.Users = append(allowed.Users, user)
+				pings = append(pings, "<@"+user+">")
+			}
+		}
+	}
+
+	payload.Content = strings.Join(pings, " ")
+
+	return used
+}
+
+// markPinged function starts the cooldown of the mention rules used by a delivered message.
+func (m *Messager) markPinged(rules []int) {
+	for _, i := range rules {
+		m.pinged[i] = time.Now()
+	}
+}
+
+func anyMatch(filter Filter, events []model.Event) bool {
+	for _, event := range events {
+		if filter.matches(event) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,124 +1,303 @@
 package core
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/NImaism/ScopeDetective/model"
-	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type Messager struct {
-	Options *Options
-}
+	Options  *Options
+	outbox   *Outbox
+	delivery *Delivery
+	wake     chan struct{}
+	flush    chan chan struct{}
+	pinged   map[int]time.Time
+	threads  *ThreadStore
+	cards    *CardStore
+	sinks    []Sink
+	discord  bool
 
-// NewMessager function creates and returns a new instance of the Messager struct.
-func NewMessager(Option *Options) *Messager {
-	return &Messager{Options: Option}
+	Delivered int64
+	Failed    int64
 }
 
-// sendMessage function sends a message to a Discord channel using a webhook.
-func (m *Messager) sendMessage(message model.Message) {
-	msg := model.DiscordMessage{
-		Content:   "",
-		Username:  "ScopeDetective",
-		AvatarUrl: "https://media.discordapp.net/attachments/996196305711943801/1144225219880423464/logo.png?width=631&height=631",
-		Embeds: []model.DiscordEmbed{
-			{
-				Title:       message.Owner,
-				Description: fmt.Sprintf("```yaml\n - 💣 Max Serverity: %s \n - 🏷 Url: %s \n```", message.MaxSeverity, message.SubDomain),
-				Url:         message.Url,
-				Color:       0xADD8E6,
-				Timestamp:   time.Now().Format(time.RFC3339),
-			},
-		},
-	}
-
-	payload, err := json.Marshal(msg)
+// NewMessager function creates and returns a new instance of the Messager struct and starts delivering queued events.
+func NewMessager(Option *Options) (*Messager, error) {
+	outbox, err := NewOutbox(filepath.Join(Option.DataDir, "queue"))
 	if err != nil {
-		return
+		return nil, fmt.Errorf("create queue directory: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", m.Options.Webhook, bytes.NewBuffer(payload))
+	sinks, err := newSinks(Option)
 	if err != nil {
-		return
+		return nil, fmt.Errorf("open local output: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	threads, err := NewThreadStore(filepath.Join(Option.DataDir, "threads.json"))
+	if err != nil {
+		return nil, err
+	}
 
-	client := &http.Client{}
-	if _, err = client.Do(req); err != nil {
-		return
+	cards, err := NewCardStore(filepath.Join(Option.DataDir, "messages.json"))
+	if err != nil {
+		return nil, err
 	}
+
+	m := &Messager{
+		Options:  Option,
+		outbox:   outbox,
+		delivery: NewDelivery(),
+		wake:     make(chan struct{}, 1),
+		flush:    make(chan chan struct{}),
+		pinged:   make(map[int]time.Time),
+		threads:  threads,
+		cards:    cards,
+		sinks:    sinks,
+	}
+	m.discord = len(m.destinations()) > 0
+
+	go m.worker()
+	m.signal()
+
+	return m, nil
 }
 
-func (m *Messager) sendSubMessage(message string, url string) {
-	msg := model.DiscordMessage{
-		Content:   "",
-		Username:  "ScopeDetective",
-		AvatarUrl: "https://media.discordapp.net/attachments/996196305711943801/1144225219880423464/logo.png?width=631&height=631",
-		Embeds: []model.DiscordEmbed{
-			{
-				Title:       "Click Me",
-				Description: message,
-				Url:         url,
-				Color:       0xADD8E6,
-				Timestamp:   time.Now().Format(time.RFC3339),
-			},
-		},
-	}
-
-	payload, err := json.Marshal(msg)
-	if err != nil {
-		return
+// Notify function persists an event to the Discord queue, wakes the delivery worker and hands the event to the
+// local sinks. It returns an error if the event could not be queued, so the caller does not record it as seen.
+func (m *Messager) Notify(event model.Event) error {
+	m.outbox.Stamp(&event)
+
+	if m.discord {
+		if err := m.outbox.Push(&event); err != nil {
+			return fmt.Errorf("queue event: %w", err)
+		}
+		m.signal()
 	}
 
-	req, err := http.NewRequest("POST", m.Options.Webhook, bytes.NewBuffer(payload))
-	if err != nil {
-		return
+	for _, sink := range m.sinks {
+		if err := sink.Write(event); err != nil {
+			fmt.Printf("\033[31m[!] Write Event Error: %s\033[0m\n", err)
+		}
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	return nil
+}
 
-	client := &http.Client{}
-	if _, err = client.Do(req); err != nil {
-		return
+// EndRun function tells the sinks that every event of a run has been raised.
+func (m *Messager) EndRun(runID string) {
+	for _, sink := range m.sinks {
+		if s, ok := sink.(runSink); ok {
+			s.EndRun(runID)
+		}
 	}
 }
 
-func (m *Messager) sendLog(message string) {
-	if !m.Options.Log {
-		return
+// Wait function blocks until the queue has been drained once and reports the delivery totals.
+func (m *Messager) Wait() {
+	done := make(chan struct{})
+	m.flush <- done
+	<-done
+
+	if failed := atomic.LoadInt64(&m.Failed); failed > 0 {
+		fmt.Printf("\033[31m[!] Messages Delivered: %d, Failed: %d\033[0m\n", atomic.LoadInt64(&m.Delivered), failed)
 	}
-	msg := model.DiscordMessage{
-		Content:   "",
-		Username:  "ScopeDetective",
-		AvatarUrl: "https://media.discordapp.net/attachments/996196305711943801/1144225219880423464/logo.png?width=631&height=631",
-		Embeds: []model.DiscordEmbed{
-			{
-				Title:       "",
-				Description: message,
-				Color:       0xADD8E6,
-				Timestamp:   time.Now().Format(time.RFC3339),
-			},
-		},
+}
+
+func (m *Messager) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
 	}
+}
 
-	payload, err := json.Marshal(msg)
-	if err != nil {
+// worker function drains the queue whenever an event arrives, and retries leftovers every minute.
+func (m *Messager) worker() {
+	retry := time.NewTicker(time.Minute)
+	defer retry.Stop()
+
+	for {
+		select {
+		case <-m.wake:
+			m.drain()
+		case <-retry.C:
+			m.drain()
+		case done := <-m.flush:
+			m.drain()
+			close(done)
+		}
+	}
+}
+
+// drain function delivers queued events in order, split by destination and batched per program. A destination that
+// is temporarily unreachable keeps its events queued for the next attempt without holding up the others.
+func (m *Messager) drain() {
+	var order []string
+	chains := make(map[string][]string)
+	routed := make(map[string][]model.Event)
+
+	for _, event := range m.outbox.Pending() {
+		chain := m.route(event)
+		key := strings.Join(chain, ">")
+		if _, ok := routed[key]; !ok {
+			order = append(order, key)
+			chains[key] = chain
+		}
+		routed[key] = append(routed[key], event)
+	}
+
+	for _, key := range order {
+		m.drainRoute(chains[key], routed[key])
+	}
+}
+
+// drainRoute function delivers the events of one destination chain, respecting its quiet hours. In digest mode
+// everything except logs is held until the oldest held event is older than the digest interval.
+func (m *Messager) drainRoute(chain []string, events []model.Event) {
+	events, ok := m.holdQuiet(chain, events)
+	if !ok {
 		return
 	}
 
-	req, err := http.NewRequest("POST", m.Options.Webhook, bytes.NewBuffer(payload))
-	if err != nil {
+	if m.Options.Digest > 0 {
+		var instant, held []model.Event
+		for _, event := range events {
+			if event.Type == model.EventLog {
+				instant = append(instant, event)
+			} else {
+				held = append(held, event)
+			}
+		}
+
+		if !m.deliverBatches(chain, instant) {
+			return
+		}
+
+		if len(held) > 0 && time.Since(held[0].Time) >= time.Duration(m.Options.Digest)*time.Hour {
+			payload, file := m.digestMessage(held)
+			m.send(chain, held, payload, file)
+		}
 		return
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	m.deliverBatches(chain, events)
+}
+
+// deliverBatches function sends events as multi-embed messages, one group per program or domain, split over as many
+// messages as Discord's limits require. A group with values embeds would truncate, or of summaryThreshold events or
+// more, is sent as a summary with the full report attached instead. When the destination edits messages, service
+// events update one status card per service instead. It reports false when Discord is unreachable.
+func (m *Messager) deliverBatches(chain []string, events []model.Event) bool {
+	if destination, ok := m.destination(chain[0]); ok && destination.Edit {
+		var cards [][]model.Event
+		cards, events = serviceCards(events)
+
+		for _, card := range cards {
+			if !m.sendCard(chain, card) {
+				return false
+			}
+		}
+	}
+
+	for _, group := range groupEvents(events) {
+		if groupKey(group[0]) != "log" && (len(group) >= summaryThreshold || oversized(group)) {
+			title := fmt.Sprintf("📑 %d Changes: %s", len(group), threadName(groupKey(group[0])))
+			payload, file := m.summaryMessage(title, group)
+			if !m.send(chain, group, payload, file) {
+				return false
+			}
+			continue
+		}
+
+		for _, chunk := range m.chunkEvents(group) {
+			var embeds []model.DiscordEmbed
+			for _, event := range chunk {
+				embeds = append(embeds, m.embed(event))
+			}
+
+			if !m.send(chain, chunk, m.message(embeds...)) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// send function adds the mentions the events call for and delivers the payload. It reports false when Discord is
+// unreachable.
+func (m *Messager) send(chain []string, events []model.Event, payload model.DiscordMessage, files ...Attachment) bool {
+	rules := m.mention(&payload, events)
+
+	err := m.deliver(chain, events, func(name string, destination Destination) error {
+		_, err := m.post(name, destination, threadKey(events), payload, files...)
+		return err
+	})
+	if err == nil {
+		m.markPinged(rules)
+	}
+
+	return err == nil || errors.Is(err, errPermanent)
+}
+
+// deliver function hands the given events to the first destination of the chain that accepts them, and settles the
+// events in the queue. When Discord is unreachable the events stay queued.
+func (m *Messager) deliver(chain []string, events []model.Event, post func(name string, destination Destination) error) error {
+	var err error
+	for _, name := range chain {
+		destination, ok := m.destination(name)
+		if !ok {
+			err = fmt.Errorf("%w: destination %q has no webhook", errPermanent, name)
+			continue
+		}
+
+		err = post(name, destination)
+		if !errors.Is(err, errPermanent) {
+			break
+		}
+		fmt.Printf("\033[31m[!] Delivery To %s Failed: %s\033[0m\n", name, err)
+	}
+
+	switch {
+	case err == nil:
+		for _, event := range events {
+			atomic.AddInt64(&m.Delivered, 1)
+			_ = m.outbox.Remove(event.ID)
+		}
+	case errors.Is(err, errPermanent):
+		fmt.Printf("\033[31m[!] Discord Delivery Failed For %d Events: %s\033[0m\n", len(events), err)
+		for _, event := range events {
+			atomic.AddInt64(&m.Failed, 1)
+			_ = m.outbox.Fail(event.ID)
+		}
+	default:
+		fmt.Printf("\033[31m[!] Discord Unreachable, Keeping %d Events Queued: %s\033[0m\n", len(events), err)
+	}
+
+	return err
+}
+
+// message function wraps embeds in a webhook message.
+func (m *Messager) message(embeds ...model.DiscordEmbed) model.DiscordMessage {
+	return model.DiscordMessage{
+		Content:   "",
+		Username:  "ScopeDetective",
+		AvatarUrl: "https://media.discordapp.net/attachments/996196305711943801/1144225219880423464/logo.png?width=631&height=631",
+		Embeds:    embeds,
+	}
+}
 
-	client := &http.Client{}
-	if _, err = client.Do(req); err != nil {
+// sendLog function queues a log message when logging is enabled.
+func (m *Messager) sendLog(message string) {
+	if !m.Options.Log {
 		return
 	}
+
+	if err := m.Notify(model.Event{Type: model.EventLog, Message: message}); err != nil {
+		fmt.Printf("\033[31m[!] %s\033[0m\n", err)
+	}
 }
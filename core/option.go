@@ -1,19 +1,45 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"github.com/projectdiscovery/goflags"
+	"os"
 	"strings"
-	"syscall"
 )
 
+// Commands lists the subcommands accepted before the flags; no command runs the monitor.
+var Commands = []string{"test-notify", "history", "export", "import"}
+
 type Options struct {
+	Command   string
 	Webhook   string
 	WildCards goflags.StringSlice
 	Excludes  map[string]bool
 	Delay     int
+	Digest    int
+	Report    string
 	Vdp       bool
 	Log       bool
+	Storage   string
+	DataDir   string
+	Config    Config
+
+	JSONL        string
+	JSONLMaxSize int
+	JSONLBackups int
+	OutputDir    string
+
+	HistoryProgram string
+	HistoryAsset   string
+	HistoryAt      string
+	HistoryDays    int
+	HistoryFormat  string
+
+	Archive string
+	Force   bool
+
+	stdout *os.File
 }
 
 // NewParser function creates and returns a new instance of the Options struct.
@@ -21,28 +47,107 @@ func NewParser() *Options {
 	return &Options{}
 }
 
-// Parse function parses command-line arguments, sets options, and displays a banner.
-func (o *Options) Parse() {
+// Parse function parses command-line arguments, sets options, and displays a banner. It reports options that are
+// missing or invalid.
+func (o *Options) Parse() error {
 	var exclude string
+	var config string
+
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		o.Command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
 
 	flagSet := goflags.NewFlagSet()
 	flagSet.StringSliceVarP(&o.WildCards, "domains", "d", nil, "domain of targets", goflags.CommaSeparatedStringSliceOptions)
 	flagSet.SetDescription("ScopeDetective Program To Get Latest Scope In HackerOne")
-	flagSet.StringVar(&o.Webhook, "webhook", "", "discord webhook url")
+	flagSet.StringVar(&o.Webhook, "webhook", "", "discord webhook url (or set SCOPEDETECTIVE_WEBHOOK / SCOPEDETECTIVE_WEBHOOK_FILE)")
 	flagSet.IntVar(&o.Delay, "delay", 10, "delay (min, default 10)")
+	flagSet.IntVar(&o.Digest, "digest", 0, "send a digest every N hours instead of instant alerts (0 = off)")
+	flagSet.StringVar(&o.Report, "report-format", "md", "format of attached change reports (md, json, csv)")
 	flagSet.BoolVar(&o.Vdp, "vdp", false, "get vdp program")
 	flagSet.BoolVar(&o.Log, "log", false, "send log")
+	flagSet.StringVar(&o.Storage, "storage", "json", "where state is kept: json (latest run only) or sqlite (full history)")
+	flagSet.StringVar(&o.DataDir, "data-dir", "", "directory holding state (default $XDG_STATE_HOME/scopedetective)")
 	flagSet.StringVar(&exclude, "exclude", "", "comma-separated list of exclude subDomain")
+	flagSet.StringVar(&config, "config", "", "yaml config file with destinations and routing rules")
+	flagSet.StringVar(&o.JSONL, "jsonl", "", "write events as json lines to a file, or - for stdout")
+	flagSet.IntVar(&o.JSONLMaxSize, "jsonl-max-size", 10, "rotate the jsonl file after this many MB (0 = never)")
+	flagSet.IntVar(&o.JSONLBackups, "jsonl-backups", 5, "number of rotated jsonl files to keep")
+	flagSet.StringVar(&o.OutputDir, "output-dir", "", "append new assets to new_scope.txt, new_subdomains.txt and new_live_urls.txt in this directory")
+	flagSet.StringVar(&o.HistoryProgram, "program", "", "history: program name, handle or url")
+	flagSet.StringVar(&o.HistoryAsset, "asset", "", "history: show when an asset appeared and disappeared")
+	flagSet.StringVar(&o.HistoryAt, "at", "", "history: show the program's scope on this date (2006-01-02 or RFC 3339)")
+	flagSet.IntVar(&o.HistoryDays, "days", 30, "history: show the program's changes over this many days")
+	flagSet.StringVar(&o.HistoryFormat, "format", "table", "history: output format (table, json)")
+	flagSet.StringVar(&o.Archive, "archive", "", "export/import: path of the state archive")
+	flagSet.BoolVar(&o.Force, "force", false, "import: replace the state already in the data directory")
 	_ = flagSet.Parse()
 
 	o.Excludes = splitStrings(exclude)
 
+	// With events or history on stdout, everything else goes to stderr so the output stays parseable.
+	o.stdout = os.Stdout
+	if o.JSONL == "-" || o.Command == "history" {
+		os.Stdout = os.Stderr
+	}
+
 	showBanner()
 
+	if o.Command != "" && !Contains(Commands, o.Command) {
+		return fmt.Errorf("unknown command %s, use one of %s", o.Command, strings.Join(Commands, ", "))
+	}
+
 	if o.Webhook == "" {
-		fmt.Println("\033[31m[!] Usage: ScopeDetective -webhook <webhook> -delay <delay> \033[0m")
-		syscall.Exit(0)
+		var err error
+		if o.Webhook, err = resolveSecret("", webhookEnv, os.Getenv(webhookFileEnv)); err != nil {
+			return fmt.Errorf("webhook secret: %w", err)
+		}
+	}
+
+	if !Contains(ReportFormats, o.Report) {
+		return fmt.Errorf("unknown report format %s, use one of %s", o.Report, strings.Join(ReportFormats, ", "))
+	}
+
+	if !Contains(Storages, o.Storage) {
+		return fmt.Errorf("unknown storage %s, use one of %s", o.Storage, strings.Join(Storages, ", "))
+	}
+
+	if o.DataDir == "" {
+		o.DataDir = defaultDataDir()
+		if _, err := os.Stat("data"); err == nil && o.DataDir != "data" {
+			fmt.Printf("\033[33m[!] State Now Lives In %s, Use -data-dir data To Keep Using ./data\033[0m\n", o.DataDir)
+		}
+	}
+
+	if config != "" {
+		var err error
+		if o.Config, err = LoadConfig(config); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+		if err := o.Config.checkDefault(o.Webhook != ""); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+	}
+
+	switch o.Command {
+	case "history":
+		if !Contains(HistoryFormats, o.HistoryFormat) {
+			return fmt.Errorf("unknown format %s, use one of %s", o.HistoryFormat, strings.Join(HistoryFormats, ", "))
+		}
+		return nil
+	case "export", "import":
+		if o.Archive == "" {
+			return fmt.Errorf("usage: ScopeDetective %s -archive <file.tar.gz> [-data-dir <dir>]", o.Command)
+		}
+		return nil
 	}
+
+	if o.Webhook == "" && len(o.Config.Destinations) == 0 && o.JSONL == "" && o.OutputDir == "" {
+		return errors.New("usage: ScopeDetective -webhook <webhook> | -config <config> | -jsonl <file> | -output-dir <dir> -delay <delay>")
+	}
+
+	return nil
 }
 
 func splitStrings(text string) map[string]bool {
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+// Outbox is an on-disk queue of events; every event is a file that lives until the event has been delivered.
+type Outbox struct {
+	Dir   string
+	mutex sync.Mutex
+	seq   int
+}
+
+// NewOutbox function creates the queue directories and returns an Outbox stored in them.
+func NewOutbox(dir string) (*Outbox, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "failed"), 0755); err != nil {
+		return nil, err
+	}
+
+	return &Outbox{Dir: dir}, nil
+}
+
+// Stamp function assigns the event an ID that sorts in queue order, and a time if it has none.
+func (o *Outbox) Stamp(event *model.Event) {
+	o.mutex.Lock()
+	o.seq = (o.seq + 1) % 10000
+	event.ID = fmt.Sprintf("%019d-%04d", time.Now().UnixNano(), o.seq)
+	o.mutex.Unlock()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+}
+
+// Push function stamps the event if needed and writes it to disk before returning.
+func (o *Outbox) Push(event *model.Event) error {
+	if event.ID == "" {
+		o.Stamp(event)
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return writeSynced(filepath.Join(o.Dir, event.ID+".json"), data)
+}
+
+// Pending function returns the queued events, oldest first. Unreadable entries are moved aside as failed.
+func (o *Outbox) Pending() []model.Event {
+	entries, err := os.ReadDir(o.Dir)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var events []model.Event
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(o.Dir, name))
+		if err != nil {
+			continue
+		}
+
+		var event model.Event
+		if err := json.Unmarshal(data, &event); err != nil {
+			fmt.Printf("\033[31m[!] Broken Queued Event %s\033[0m\n", name)
+			_ = os.Rename(filepath.Join(o.Dir, name), filepath.Join(o.Dir, "failed", name))
+			continue
+		}
+		events = append(events, event)
+	}
+
+	return events
+}
+
+// Remove function deletes a delivered event from the queue.
+func (o *Outbox) Remove(id string) error {
+	return os.Remove(filepath.Join(o.Dir, id+".json"))
+}
+
+// Fail function moves an event that can never be delivered out of the queue so it no longer blocks it.
+func (o *Outbox) Fail(id string) error {
+	return os.Rename(filepath.Join(o.Dir, id+".json"), filepath.Join(o.Dir, "failed", id+".json"))
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+// QuietHours is a daily window in which a destination only receives urgent events; the rest is held and sent as
+// a digest once the window ends.
+type QuietHours struct {
+	Start    string   `yaml:"start"`
+	End      string   `yaml:"end"`
+	Timezone string   `yaml:"timezone"`
+	Urgent   []Filter `yaml:"urgent"`
+
+	location *time.Location
+	from     int
+	to       int
+}
+
+// parse function checks the window and resolves its time zone.
+func (q *QuietHours) parse() error {
+	var err error
+	if q.location, err = time.LoadLocation(q.Timezone); err != nil {
+		return err
+	}
+
+	if q.from, err = minuteOfDay(q.Start); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	if q.to, err = minuteOfDay(q.End); err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+
+	return nil
+}
+
+// contains function reports whether a moment falls inside the window. Windows may wrap past midnight.
+func (q *QuietHours) contains(moment time.Time) bool {
+	local := moment.In(q.location)
+	minute := local.Hour()*60 + local.Minute()
+
+	if q.from <= q.to {
+		return minute >= q.from && minute < q.to
+	}
+
+	return minute >= q.from || minute < q.to
+}
+
+// urgent function reports whether an event may break through the window.
+func (q *QuietHours) urgent(event model.Event) bool {
+	for _, filter := range q.Urgent {
+		if filter.matches(event) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func minuteOfDay(clock string) (int, error) {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// holdQuiet function applies the quiet hours of the chain's first destination. During the window it returns only the
+// urgent events and keeps the rest queued; after it, events raised during the window are sent as one digest first.
+// It reports false when Discord is unreachable.
+func (m *Messager) holdQuiet(chain []string, events []model.Event) ([]model.Event, bool) {
+	destination, ok := m.destination(chain[0])
+	if !ok || destination.QuietHours == nil {
+		return events, true
+	}
+	quiet := destination.QuietHours
+
+	var urgent, held, rest []model.Event
+	for _, event := range events {
+		switch {
+		case quiet.urgent(event):
+			urgent = append(urgent, event)
+		case quiet.contains(event.Time):
+			held = append(held, event)
+		default:
+			rest = append(rest, event)
+		}
+	}
+
+	if quiet.contains(time.Now()) {
+		return urgent, true
+	}
+
+	if len(held) > 0 {
+		title := fmt.Sprintf("🌙 %d Events Held During Quiet Hours", len(held))
+		payload, file := m.summaryMessage(title, held)
+		if !m.send(chain, held, payload, file) {
+			return nil, false
+		}
+	}
+
+	return append(urgent, rest...), true
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+// ReportFormats lists the formats a change report can be attached in.
+var ReportFormats = []string{"md", "json", "csv"}
+
+var unsafeFileName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+var reportColumns = []string{"time", "type", "source", "run_id", "program", "domain", "asset", "asset_type", "severity", "bounty", "old", "new", "title", "status", "code", "words", "technology"}
+
+// report function renders the full change set of events as a file in the given format.
+func report(format string, events []model.Event) Attachment {
+	name := fmt.Sprintf("report-%s-%s", threadName(threadKey(events)), time.Now().UTC().Format("20060102-150405"))
+	name = strings.Trim(unsafeFileName.ReplaceAllString(name, "_"), "_")
+
+	switch format {
+	case "json":
+		data, _ := json.MarshalIndent(events, "", "  ")
+		return Attachment{Name: name + ".json", Data: data}
+	case "csv":
+		buffer := &bytes.Buffer{}
+		writer := csv.NewWriter(buffer)
+		_ = writer.Write(reportColumns)
+		for _, event := range events {
+			_ = writer.Write(reportRow(event))
+		}
+		writer.Flush()
+		return Attachment{Name: name + ".csv", Data: buffer.Bytes()}
+	}
+
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, "# ScopeDetective Report\n\n%d events, generated %s\n\n", len(events), time.Now().UTC().Format(time.RFC3339))
+	buffer.WriteString("| " + strings.Join(reportColumns, " | ") + " |\n")
+	buffer.WriteString(strings.Repeat("| --- ", len(reportColumns)) + "|\n")
+	for _, event := range events {
+		row := reportRow(event)
+		for i, cell := range row {
+			row[i] = strings.NewReplacer("|", "\\|", "\n", "<br>").Replace(cell)
+		}
+		buffer.WriteString("| " + strings.Join(row, " | ") + " |\n")
+	}
+
+	return Attachment{Name: name + ".md", Data: buffer.Bytes()}
+}
+
+// reportRow function flattens an event into the values of reportColumns.
+func reportRow(event model.Event) []string {
+	row := []string{
+		event.Time.UTC().Format(time.RFC3339),
+		string(event.Type),
+		event.Source,
+		event.RunID,
+		event.Program,
+		event.Domain,
+		event.Asset,
+		event.AssetType,
+		event.Severity,
+		strconv.FormatBool(event.Bounty),
+		event.Old,
+		event.New,
+		"", "", "", "", "",
+	}
+
+	if event.Service != nil {
+		row[12] = event.Service.Title
+		row[13] = strconv.FormatBool(event.Service.Status)
+		row[14] = strings.Join(event.Service.Code, " ")
+		row[15] = strconv.Itoa(event.Service.Words)
+		row[16] = strings.Join(event.Service.Technology, ", ")
+	}
+
+	return row
+}
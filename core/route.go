@@ -0,0 +1,90 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+// route function returns the destinations to try for an event, in order: the first matching route's destination,
+// its fallback, and finally the default destination.
+func (m *Messager) route(event model.Event) []string {
+	config := m.Options.Config
+
+	fallback := config.Default
+	if fallback == "" {
+		fallback = defaultDestination
+	}
+
+	for _, route := range config.Routes {
+		if !route.matches(event) {
+			continue
+		}
+
+		chain := []string{route.Destination}
+		if route.Fallback != "" && route.Fallback != route.Destination {
+			chain = append(chain, route.Fallback)
+		}
+		if !Contains(chain, fallback) {
+			chain = append(chain, fallback)
+		}
+		return chain
+	}
+
+	return []string{fallback}
+}
+
+// destination function looks up a destination by name; the default destination falls back to the -webhook flag.
+func (m *Messager) destination(name string) (Destination, bool) {
+	if d, ok := m.Options.Config.Destinations[name]; ok {
+		return d, d.Webhook != ""
+	}
+
+	if name == defaultDestination && m.Options.Webhook != "" {
+		return Destination{Webhook: m.Options.Webhook}, true
+	}
+
+	return Destination{}, false
+}
+
+// matches function reports whether an event passes every list set on the filter.
+func (r Filter) matches(event model.Event) bool {
+	if len(r.Types) > 0 && !containsType(r.Types, event.Type) {
+		return false
+	}
+
+	if len(r.Programs) > 0 && !containsFold(r.Programs, event.Program) {
+		return false
+	}
+
+	if len(r.Severities) > 0 && !containsFold(r.Severities, event.Severity) {
+		return false
+	}
+
+	if len(r.Domains) > 0 && !containsFold(r.Domains, event.Domain) {
+		return false
+	}
+
+	return true
+}
+
+func containsType(list []model.EventType, item model.EventType) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsFold function checks if an item exists in a list, ignoring case.
+func containsFold(list []string, item string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, item) {
+			return true
+		}
+	}
+
+	return false
+}
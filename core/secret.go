@@ -0,0 +1,52 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Environment variables read when -webhook is not given.
+const (
+	webhookEnv     = "SCOPEDETECTIVE_WEBHOOK"
+	webhookFileEnv = "SCOPEDETECTIVE_WEBHOOK_FILE"
+)
+
+// resolveSecret function returns a credential from the first source that is set: the literal value, the environment
+// variable named env, or the content of file (Docker and Kubernetes secrets).
+func resolveSecret(value string, env string, file string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+
+	if env != "" {
+		if secret := os.Getenv(env); secret != "" {
+			return secret, nil
+		}
+	}
+
+	if file == "" {
+		return "", nil
+	}
+
+	warnWorldReadable(file)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("read secret file: %w", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// warnWorldReadable function warns when a file holding secrets can be read by every user on the machine.
+func warnWorldReadable(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	if info.Mode().Perm()&0004 != 0 {
+		fmt.Printf("\033[33m[!] %s Is World-Readable, Restrict It With: chmod 600 %s\033[0m\n", path, path)
+	}
+}
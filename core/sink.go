@@ -0,0 +1,204 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+// recordSchema is bumped whenever a field of record changes meaning or is removed.
+const recordSchema = 1
+
+// Sink receives every event as soon as it is raised, next to or instead of Discord.
+type Sink interface {
+	Write(event model.Event) error
+}
+
+// runSink is a sink that also wants to know when a monitoring run is over.
+type runSink interface {
+	EndRun(runID string)
+}
+
+// record is the stable JSON shape events are written in by local sinks, one object per line.
+type record struct {
+	Schema      int            `json:"schema"`
+	ID          string         `json:"id"`
+	Type        string         `json:"type"`
+	Time        string         `json:"time"`
+	Source      string         `json:"source,omitempty"`
+	RunID       string         `json:"run_id,omitempty"`
+	Program     string         `json:"program,omitempty"`
+	ProgramURL  string         `json:"program_url,omitempty"`
+	Domain      string         `json:"domain,omitempty"`
+	Asset       string         `json:"asset,omitempty"`
+	AssetType   string         `json:"asset_type,omitempty"`
+	Severity    string         `json:"severity,omitempty"`
+	Bounty      bool           `json:"bounty"`
+	Instruction string         `json:"instruction,omitempty"`
+	Message     string         `json:"message,omitempty"`
+	Old         string         `json:"old,omitempty"`
+	New         string         `json:"new,omitempty"`
+	Service     *recordService `json:"service,omitempty"`
+}
+
+type recordService struct {
+	URL        string   `json:"url"`
+	Title      string   `json:"title"`
+	Status     bool     `json:"status"`
+	Code       []string `json:"code"`
+	Words      int      `json:"words"`
+	Technology []string `json:"technology"`
+}
+
+// newRecord function converts an event into its JSON line schema.
+func newRecord(event model.Event) record {
+	r := record{
+		Schema:      recordSchema,
+		ID:          event.ID,
+		Type:        string(event.Type),
+		Time:        event.Time.UTC().Format(time.RFC3339Nano),
+		Source:      event.Source,
+		RunID:       event.RunID,
+		Program:     event.Program,
+		ProgramURL:  event.ProgramURL,
+		Domain:      event.Domain,
+		Asset:       event.Asset,
+		AssetType:   event.AssetType,
+		Severity:    event.Severity,
+		Bounty:      event.Bounty,
+		Instruction: event.Instruction,
+		Message:     event.Message,
+		Old:         event.Old,
+		New:         event.New,
+	}
+
+	if service := event.Service; service != nil {
+		r.Service = &recordService{
+			URL:        service.URL,
+			Title:      service.Title,
+			Status:     service.Status,
+			Code:       service.Code,
+			Words:      service.Words,
+			Technology: service.Technology,
+		}
+	}
+
+	return r
+}
+
+// JSONLSink writes events as JSON lines to a stream, or to a file that is rotated once it grows past MaxSize.
+type JSONLSink struct {
+	Path    string
+	MaxSize int64
+	Backups int
+
+	mutex  sync.Mutex
+	writer io.Writer
+	file   *os.File
+	size   int64
+}
+
+// NewJSONLSink function opens a sink writing to the given stream, or to the file at path if the stream is nil.
+func NewJSONLSink(stream io.Writer, path string, maxSize int64, backups int) (*JSONLSink, error) {
+	sink := &JSONLSink{Path: path, MaxSize: maxSize, Backups: backups, writer: stream}
+	if stream != nil {
+		return sink, nil
+	}
+
+	return sink, sink.open()
+}
+
+// Write function appends one event as a JSON line, rotating the file first if the line would not fit.
+func (s *JSONLSink) Write(event model.Event) error {
+	line, err := json.Marshal(newRecord(event))
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file != nil && s.MaxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.MaxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.writer.Write(line)
+	s.size += int64(n)
+
+	return err
+}
+
+func (s *JSONLSink) open() error {
+	file, err := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file, s.writer, s.size = file, file, info.Size()
+
+	return nil
+}
+
+// rotate function shifts path.1 … path.N up by one, dropping the oldest, moves the current file to path.1 and
+// starts a new one.
+func (s *JSONLSink) rotate() error {
+	s.file.Close()
+
+	for i := s.Backups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", s.Path, i), fmt.Sprintf("%s.%d", s.Path, i+1))
+	}
+
+	if s.Backups > 0 {
+		_ = os.Rename(s.Path, s.Path+".1")
+	} else {
+		_ = os.Remove(s.Path)
+	}
+
+	return s.open()
+}
+
+// newSinks function opens the local sinks requested by the options.
+func newSinks(o *Options) ([]Sink, error) {
+	var sinks []Sink
+
+	if o.JSONL != "" {
+		var stream io.Writer
+		if o.JSONL == "-" {
+			stream = o.stdout
+		}
+
+		sink, err := NewJSONLSink(stream, o.JSONL, int64(o.JSONLMaxSize)<<20, o.JSONLBackups)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if o.OutputDir != "" {
+		sink, err := NewAnewSink(o.OutputDir)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if len(o.Config.Hooks) > 0 {
+		sinks = append(sinks, NewHookSink(o.Config.Hooks, o.Config.HookLimit))
+	}
+
+	return sinks, nil
+}
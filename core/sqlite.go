@@ -0,0 +1,449 @@
+package core
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NImaism/ScopeDetective/model"
+	_ "modernc.org/sqlite"
+)
+
+// Every observed item is stored as a span: a row says the item was seen, exactly as described by its columns, in
+// every run of its kind from first_seen to last_seen. A run that sees the item unchanged extends the span; a change,
+// or a gap, starts a new one. Times are unix seconds.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id     TEXT PRIMARY KEY,
+	kind   TEXT NOT NULL,
+	source TEXT NOT NULL,
+	time   INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS runs_kind_time ON runs (kind, time);
+
+CREATE TABLE IF NOT EXISTS programs (
+	url        TEXT NOT NULL,
+	handle     TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	bounties   INTEGER NOT NULL,
+	state      TEXT NOT NULL,
+	first_seen INTEGER NOT NULL,
+	last_seen  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS programs_last_seen ON programs (last_seen);
+
+CREATE TABLE IF NOT EXISTS scopes (
+	program_url TEXT NOT NULL,
+	asset       TEXT NOT NULL,
+	asset_type  TEXT NOT NULL,
+	severity    TEXT NOT NULL,
+	bounty      INTEGER NOT NULL,
+	eligible    INTEGER NOT NULL,
+	instruction TEXT NOT NULL,
+	first_seen  INTEGER NOT NULL,
+	last_seen   INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS scopes_last_seen ON scopes (last_seen);
+CREATE INDEX IF NOT EXISTS scopes_asset ON scopes (asset);
+
+CREATE TABLE IF NOT EXISTS subdomains (
+	host       TEXT NOT NULL,
+	first_seen INTEGER NOT NULL,
+	last_seen  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS subdomains_last_seen ON subdomains (last_seen);
+
+CREATE TABLE IF NOT EXISTS services (
+	url        TEXT NOT NULL,
+	title      TEXT NOT NULL,
+	status     INTEGER NOT NULL,
+	code       TEXT NOT NULL,
+	words      INTEGER NOT NULL,
+	technology TEXT NOT NULL,
+	first_seen INTEGER NOT NULL,
+	last_seen  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS services_last_seen ON services (last_seen);
+`
+
+// databaseName is the SQLite database in the data directory.
+const databaseName = "ScopeDetective.db"
+
+// sqliteMigrations upgrade the database from the version of their index to the next one. Append, never edit.
+var sqliteMigrations = []string{sqliteSchema}
+
+const (
+	runScopes   = "scopes"
+	runServices = "services"
+)
+
+var (
+	programColumns = []string{"url", "handle", "name", "bounties", "state"}
+	scopeColumns   = []string{"program_url", "asset", "asset_type", "severity", "bounty", "eligible", "instruction"}
+)
+
+// observations are the rows one run saw in a table, each holding the table's columns in order.
+type observations struct {
+	table   string
+	columns []string
+	rows    [][]any
+}
+
+// SQLiteStore keeps the full history of every observation in a SQLite database.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteStore function opens, or creates, the database at path.
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// Both monitors share the store; one connection keeps their writes from tripping over each other.
+	db.SetMaxOpenConns(1)
+
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// OpenSQLiteStoreReadOnly function opens the database at path without ever writing to it, for commands that run
+// next to a live instance without the data directory lock. Nothing is migrated, so a database of another version is
+// refused.
+func OpenSQLiteStoreReadOnly(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	var version int
+	err = db.QueryRow("PRAGMA user_version").Scan(&version)
+	switch {
+	case err != nil:
+	case version > len(sqliteMigrations):
+		err = fmt.Errorf("%w (version %d, this one reads up to %d)", errFutureState, version, len(sqliteMigrations))
+	case version < len(sqliteMigrations):
+		err = fmt.Errorf("version %d is out of date, run the monitor once to upgrade it to %d", version, len(sqliteMigrations))
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// migrateSQLite function creates the schema of a new database and upgrades an older one, step by step. The version
+// is kept in SQLite's user_version; a database of a newer release is refused.
+func migrateSQLite(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("%w (version %d, this one reads up to %d)", errFutureState, version, len(sqliteMigrations))
+	}
+
+	for ; version < len(sqliteMigrations); version++ {
+		if _, err := db.Exec(sqliteMigrations[version]); err != nil {
+			return fmt.Errorf("upgrade from version %d: %w", version, err)
+		}
+		if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Scopes function returns the URL assets open for submission in the last scope run.
+func (s *SQLiteStore) Scopes() ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT asset FROM scopes
+		WHERE last_seen = (SELECT MAX(time) FROM runs WHERE kind = ?) AND asset_type = 'URL' AND eligible = 1`, runScopes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []string
+	for rows.Next() {
+		var asset string
+		if err := rows.Scan(&asset); err != nil {
+			return nil, err
+		}
+		subs = append(subs, asset)
+	}
+
+	return subs, rows.Err()
+}
+
+// RecordScopes function starts the transaction a scope run is recorded in; the programs added to the recorder are
+// written as they come.
+func (s *SQLiteStore) RecordScopes(run Run) (ScopeRecorder, error) {
+	tx, previous, err := s.begin(run, runScopes)
+	if err != nil {
+		return nil, err
+	}
+
+	now := run.Time.Unix()
+	programs, err := newObserver(tx, "programs", programColumns, previous, now)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	scopes, err := newObserver(tx, "scopes", scopeColumns, previous, now)
+	if err != nil {
+		programs.close()
+		tx.Rollback()
+		return nil, err
+	}
+
+	return &sqliteScopeRecorder{tx: tx, programs: programs, scopes: scopes}, nil
+}
+
+// Services function returns the services seen by the last service run.
+func (s *SQLiteStore) Services() ([]model.Sub, error) {
+	rows, err := s.db.Query(`SELECT url, title, status, code, words, technology FROM services
+		WHERE last_seen = (SELECT MAX(time) FROM runs WHERE kind = ?)`, runServices)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []model.Sub
+	for rows.Next() {
+		var sub model.Sub
+		var code, technology string
+		if err := rows.Scan(&sub.URL, &sub.Title, &sub.Status, &code, &sub.Words, &technology); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal([]byte(code), &sub.Code)
+		_ = json.Unmarshal([]byte(technology), &sub.Technology)
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+// SaveServices function records the subdomains and service snapshots of a run.
+func (s *SQLiteStore) SaveServices(run Run, subdomains []string, services []model.Sub) error {
+	subdomainRows := observations{table: "subdomains", columns: []string{"host"}}
+	serviceRows := observations{table: "services", columns: []string{"url", "title", "status", "code", "words", "technology"}}
+
+	for _, host := range subdomains {
+		subdomainRows.rows = append(subdomainRows.rows, []any{host})
+	}
+	for _, service := range services {
+		code, _ := json.Marshal(service.Code)
+		technology, _ := json.Marshal(service.Technology)
+		serviceRows.rows = append(serviceRows.rows, []any{service.URL, service.Title, sqlBool(service.Status), string(code), int64(service.Words), string(technology)})
+	}
+
+	return s.record(run, runServices, subdomainRows, serviceRows)
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// record function stores a run and its observations in one transaction, extending the spans of items the previous
+// run of the same kind saw unchanged.
+func (s *SQLiteStore) record(run Run, kind string, tables ...observations) error {
+	tx, previous, err := s.begin(run, kind)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range tables {
+		observer, err := newObserver(tx, table.table, table.columns, previous, run.Time.Unix())
+		if err != nil {
+			return fmt.Errorf("%s: %w", table.table, err)
+		}
+
+		for _, row := range table.rows {
+			if err := observer.add(row); err != nil {
+				observer.close()
+				return err
+			}
+		}
+		observer.close()
+	}
+
+	return tx.Commit()
+}
+
+// begin function opens the transaction of a run and inserts the run, returning the time of the previous run of the
+// same kind, or 0 if there is none.
+func (s *SQLiteStore) begin(run Run, kind string) (*sql.Tx, int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var previous sql.NullInt64
+	if err := tx.QueryRow("SELECT MAX(time) FROM runs WHERE kind = ?", kind).Scan(&previous); err != nil {
+		tx.Rollback()
+		return nil, 0, err
+	}
+
+	if _, err := tx.Exec("INSERT INTO runs (id, kind, source, time) VALUES (?, ?, ?, ?)", run.ID, kind, run.Source, run.Time.Unix()); err != nil {
+		tx.Rollback()
+		return nil, 0, err
+	}
+
+	return tx, previous.Int64, nil
+}
+
+// sqliteScopeRecorder writes the programs of a scope run into its transaction as they are added.
+type sqliteScopeRecorder struct {
+	tx       *sql.Tx
+	programs *observer
+	scopes   *observer
+}
+
+func (r *sqliteScopeRecorder) Add(program model.JsonData) error {
+	if err := r.programs.add([]any{program.URL, program.Handle, program.Name, sqlBool(program.OffersBounties), program.SubmissionState}); err != nil {
+		return err
+	}
+
+	for _, item := range program.Targets.InScope {
+		if err := r.scopes.add([]any{program.URL, item.AssetIdentifier, item.AssetType, item.MaxSeverity, sqlBool(item.EligibleForBounty), sqlBool(item.EligibleForSubmission), item.Instruction}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *sqliteScopeRecorder) Commit() error {
+	r.programs.close()
+	r.scopes.close()
+
+	return r.tx.Commit()
+}
+
+func (r *sqliteScopeRecorder) Discard() {
+	r.programs.close()
+	r.scopes.close()
+	_ = r.tx.Rollback()
+}
+
+// observer records the rows one run sees in a table, one at a time: it extends the span of every row the previous
+// run saw exactly the same way, and starts a new span for the rest. Rows are tracked by the hash of their values, so
+// its memory does not grow with the size of the values.
+type observer struct {
+	open   map[rowHash]int64
+	seen   map[rowHash]bool
+	extend *sql.Stmt
+	insert *sql.Stmt
+	now    int64
+}
+
+// rowHash identifies a row by the SHA-256 of all of its values.
+type rowHash [sha256.Size]byte
+
+// newObserver function loads the rows of table the previous run saw, and prepares the statements of the run.
+func newObserver(tx *sql.Tx, table string, columns []string, previous int64, now int64) (*observer, error) {
+	o := &observer{open: make(map[rowHash]int64), seen: make(map[rowHash]bool), now: now}
+	names := strings.Join(columns, ", ")
+
+	if previous != 0 {
+		rows, err := tx.Query(fmt.Sprintf("SELECT rowid, %s FROM %s WHERE last_seen = ?", names, table), previous)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var rowid int64
+			values := make([]any, len(columns))
+			targets := []any{&rowid}
+			for i := range values {
+				targets = append(targets, &values[i])
+			}
+
+			if err := rows.Scan(targets...); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			o.open[rowKey(values)] = rowid
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if o.extend, err = tx.Prepare(fmt.Sprintf("UPDATE %s SET last_seen = ? WHERE rowid = ?", table)); err != nil {
+		return nil, err
+	}
+
+	o.insert, err = tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s, first_seen, last_seen) VALUES (%s?, ?)",
+		table, names, strings.Repeat("?, ", len(columns))))
+	if err != nil {
+		o.extend.Close()
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// add function records one row, once per run however often it is seen.
+func (o *observer) add(row []any) error {
+	key := rowKey(row)
+	if o.seen[key] {
+		return nil
+	}
+	o.seen[key] = true
+
+	if rowid, ok := o.open[key]; ok {
+		_, err := o.extend.Exec(o.now, rowid)
+		return err
+	}
+
+	_, err := o.insert.Exec(append(row, o.now, o.now)...)
+	return err
+}
+
+func (o *observer) close() {
+	o.extend.Close()
+	o.insert.Close()
+}
+
+// rowKey function hashes all of the values of a row.
+func rowKey(values []any) rowHash {
+	hash := sha256.New()
+	for _, value := range values {
+		fmt.Fprintf(hash, "%v\x00", value)
+	}
+
+	var key rowHash
+	hash.Sum(key[:0])
+
+	return key
+}
+
+func sqlBool(value bool) int64 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,245 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// backupSuffix is appended to a state file's name for the copy of its previous generation.
+const backupSuffix = ".bak"
+
+// stateVersion is the version state files are written in. Bump it together with a migration in stateMigrations
+// whenever the data of a kind changes shape.
+const stateVersion = 1
+
+// Kinds of state files; the kind is recorded in the file so one can never be loaded as another.
+const (
+	stateScopes   = "scopes"
+	stateServices = "services"
+	stateThreads  = "threads"
+	stateCards    = "cards"
+	stateDataset  = "dataset"
+)
+
+// stateFiles maps the state files of the data directory to their kind.
+var stateFiles = map[string]string{
+	"Scopes.json":   stateScopes,
+	"Subs.json":     stateServices,
+	"threads.json":  stateThreads,
+	"messages.json": stateCards,
+	"dataset.json":  stateDataset,
+}
+
+// stateMigrations upgrade the data of a kind from a version to the next one, keyed by kind and the version they
+// upgrade from. A missing step leaves the data as it is. Version 0 is the bare data written before state files
+// were versioned.
+var stateMigrations = map[string]map[int]func(data json.RawMessage) (json.RawMessage, error){}
+
+// errFutureState is returned for state written by a newer release, which must be neither read nor overwritten.
+var errFutureState = errors.New("written by a newer version of ScopeDetective")
+
+// stateEnvelope wraps the data of every state file with its kind and version.
+type stateEnvelope struct {
+	Version int             `json:"version"`
+	Kind    string          `json:"kind"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// stateSource tells where loadState found the state of a file.
+type stateSource int
+
+const (
+	stateMissing stateSource = iota
+	stateCurrent
+	stateOutdated
+	stateBackup
+)
+
+// readState function loads the state file of a kind at path into value, leaving value untouched when there is no
+// state yet. Files of older versions are upgraded in place. A missing or damaged file is restored from its backup;
+// when the backup is unusable too an error is returned rather than letting the caller start over and lose the
+// changes since the last good state.
+func readState(path string, kind string, value any) error {
+	source, err := loadState(path, kind, value)
+	if err != nil {
+		return err
+	}
+
+	switch source {
+	case stateOutdated:
+		fmt.Printf("\033[34m[+] Upgraded %s To Version %d\033[0m\n", path, stateVersion)
+		return writeState(path, kind, value)
+	case stateBackup:
+		data, err := encodeState(kind, value)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\033[33m[!] Restored %s From Backup\033[0m\n", path)
+		return writeSynced(path, data)
+	}
+
+	return nil
+}
+
+// peekState function loads state like readState, but never writes: an older version is upgraded in memory only and a
+// damaged file is read from its backup without restoring it. Commands that run without the data directory lock read
+// state this way, so they never touch files a running instance owns.
+func peekState(path string, kind string, value any) error {
+	_, err := loadState(path, kind, value)
+	return err
+}
+
+// loadState function decodes the state file at path, or its backup when the file is missing or damaged, into value
+// and reports which one it used.
+func loadState(path string, kind string, value any) (stateSource, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		version, decodeErr := decodeState(data, kind, value)
+		switch {
+		case decodeErr == nil && version < stateVersion:
+			return stateOutdated, nil
+		case decodeErr == nil:
+			return stateCurrent, nil
+		case errors.Is(decodeErr, errFutureState):
+			return stateMissing, fmt.Errorf("%s: %w", path, decodeErr)
+		}
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return stateMissing, err
+	}
+
+	backup, backupErr := os.ReadFile(path + backupSuffix)
+	switch {
+	case os.IsNotExist(backupErr) && err != nil:
+		return stateMissing, nil
+	case os.IsNotExist(backupErr):
+		return stateMissing, fmt.Errorf("%s is damaged and has no backup, move it away to start a new baseline", path)
+	case backupErr != nil:
+		return stateMissing, backupErr
+	}
+
+	if _, err := decodeState(backup, kind, value); err != nil {
+		if errors.Is(err, errFutureState) {
+			return stateMissing, fmt.Errorf("%s: %w", path+backupSuffix, err)
+		}
+		return stateMissing, fmt.Errorf("%s and its backup are damaged, move them away to start a new baseline", path)
+	}
+
+	return stateBackup, nil
+}
+
+// writeState function replaces the state file of a kind at path with value, keeping its current generation as a
+// backup if it is intact.
+func writeState(path string, kind string, value any) error {
+	data, err := encodeState(kind, value)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if current, err := os.ReadFile(path); err == nil && json.Valid(current) {
+		if err := writeSynced(path+backupSuffix, current); err != nil {
+			return err
+		}
+	}
+
+	return writeSynced(path, data)
+}
+
+// encodeState function wraps value in an envelope of the current version.
+func encodeState(kind string, value any) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(stateEnvelope{Version: stateVersion, Kind: kind, Data: data})
+}
+
+// decodeState function unwraps a state file of a kind into value, running the migrations from its version to the
+// current one, and returns the version it was written in.
+func decodeState(data []byte, kind string, value any) (int, error) {
+	envelope := stateEnvelope{Data: data}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) == nil && fields["version"] != nil && fields["kind"] != nil && fields["data"] != nil {
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			return 0, err
+		}
+	}
+
+	switch {
+	case envelope.Version > stateVersion:
+		return envelope.Version, fmt.Errorf("%w (version %d, this one reads up to %d)", errFutureState, envelope.Version, stateVersion)
+	case envelope.Version > 0 && envelope.Kind != kind:
+		return envelope.Version, fmt.Errorf("holds %s, not %s", envelope.Kind, kind)
+	}
+
+	for version := envelope.Version; version < stateVersion; version++ {
+		migrate := stateMigrations[kind][version]
+		if migrate == nil {
+			continue
+		}
+
+		var err error
+		if envelope.Data, err = migrate(envelope.Data); err != nil {
+			return envelope.Version, fmt.Errorf("upgrade from version %d: %w", version, err)
+		}
+	}
+
+	return envelope.Version, json.Unmarshal(envelope.Data, value)
+}
+
+// writeSynced function writes data to a temporary file next to path, flushes it to disk and renames it over path,
+// so a crash leaves either the old or the new content but never a mix of both.
+func writeSynced(path string, data []byte) error {
+	dir := filepath.Dir(path)
+
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	temp := file.Name()
+
+	if err := writeAndSync(file, data); err != nil {
+		file.Close()
+		os.Remove(temp)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	// Flush the rename itself; not every platform can sync a directory, which only costs durability there.
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
+
+func writeAndSync(file *os.File, data []byte) error {
+	if err := file.Chmod(0644); err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
@@ -0,0 +1,235 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadState(t *testing.T) {
+	current := `{"version":1,"kind":"scopes","data":["a.com"]}`
+	previous := `{"version":1,"kind":"scopes","data":["b.com"]}`
+
+	cases := []struct {
+		name    string
+		file    string // content of the state file, none if empty
+		backup  string // content of its backup, none if empty
+		want    []string
+		wantErr string
+		// restored is true when the state file must have been rewritten in the current version.
+		restored bool
+	}{
+		{name: "no state", want: nil},
+		{name: "current version", file: current, want: []string{"a.com"}},
+		{name: "bare version 0 is upgraded", file: `["a.com"]`, want: []string{"a.com"}, restored: true},
+		{name: "future version is refused", file: `{"version":2,"kind":"scopes","data":["a.com"]}`, backup: previous, wantErr: errFutureState.Error()},
+		{name: "other kind without backup", file: `{"version":1,"kind":"threads","data":{}}`, wantErr: "damaged and has no backup"},
+		{name: "other kind with backup", file: `{"version":1,"kind":"threads","data":{}}`, backup: previous, want: []string{"b.com"}, restored: true},
+		{name: "damaged without backup", file: `["a.c`, wantErr: "damaged and has no backup"},
+		{name: "damaged with backup", file: `["a.c`, backup: previous, want: []string{"b.com"}, restored: true},
+		{name: "missing with backup", backup: previous, want: []string{"b.com"}, restored: true},
+		{name: "both damaged", file: `["a.c`, backup: `{"vers`, wantErr: "and its backup are damaged"},
+		{name: "future backup is refused", file: `["a.c`, backup: `{"version":2,"kind":"scopes","data":[]}`, wantErr: errFutureState.Error()},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "Scopes.json")
+			if c.file != "" {
+				writeFile(t, path, c.file)
+			}
+			if c.backup != "" {
+				writeFile(t, path+backupSuffix, c.backup)
+			}
+
+			var got []string
+			err := readState(path, stateScopes, &got)
+
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("error = %v, want %q", err, c.wantErr)
+				}
+				if c.file != "" && readFile(t, path) != c.file {
+					t.Fatalf("state file was changed after an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("got %v, want %v", got, c.want)
+			}
+
+			if c.restored {
+				var envelope stateEnvelope
+				if err := json.Unmarshal([]byte(readFile(t, path)), &envelope); err != nil || envelope.Version != stateVersion || envelope.Kind != stateScopes {
+					t.Fatalf("state file not rewritten in the current version: %s", readFile(t, path))
+				}
+			}
+		})
+	}
+}
+
+func TestPeekState(t *testing.T) {
+	cases := []struct {
+		name   string
+		file   string
+		backup string
+		want   []string
+	}{
+		{name: "bare version 0 is not upgraded", file: `["a.com"]`, want: []string{"a.com"}},
+		{name: "damaged file is not restored", file: `["a.c`, backup: `{"version":1,"kind":"scopes","data":["b.com"]}`, want: []string{"b.com"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "Scopes.json")
+			writeFile(t, path, c.file)
+			if c.backup != "" {
+				writeFile(t, path+backupSuffix, c.backup)
+			}
+
+			var got []string
+			if err := peekState(path, stateScopes, &got); err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("got %v, want %v", got, c.want)
+			}
+			if readFile(t, path) != c.file {
+				t.Fatalf("state file was written: %s", readFile(t, path))
+			}
+		})
+	}
+}
+
+func TestDecodeStateMigrations(t *testing.T) {
+	stateMigrations["test"] = map[int]func(json.RawMessage) (json.RawMessage, error){
+		0: func(data json.RawMessage) (json.RawMessage, error) {
+			var assets []string
+			if err := json.Unmarshal(data, &assets); err != nil {
+				return nil, err
+			}
+			return json.Marshal(map[string][]string{"assets": assets})
+		},
+	}
+	defer delete(stateMigrations, "test")
+
+	cases := []struct {
+		name        string
+		data        string
+		want        map[string][]string
+		wantVersion int
+		wantErr     string
+	}{
+		{name: "version 0 is migrated", data: `["a.com"]`, want: map[string][]string{"assets": {"a.com"}}},
+		{name: "current version is not migrated", data: `{"version":1,"kind":"test","data":{"assets":["a.com"]}}`, want: map[string][]string{"assets": {"a.com"}}, wantVersion: 1},
+		{name: "failing migration", data: `{"a":1}`, wantErr: "upgrade from version 0"},
+		{name: "kind mismatch", data: `{"version":1,"kind":"scopes","data":[]}`, wantVersion: 1, wantErr: "holds scopes, not test"},
+		{name: "future version", data: `{"version":9,"kind":"test","data":{}}`, wantVersion: 9, wantErr: errFutureState.Error()},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got map[string][]string
+			version, err := decodeState([]byte(c.data), "test", &got)
+
+			if version != c.wantVersion {
+				t.Fatalf("version = %d, want %d", version, c.wantVersion)
+			}
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("error = %v, want %q", err, c.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestWriteState(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state", "Scopes.json")
+
+	if err := writeState(path, stateScopes, []string{"a.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + backupSuffix); !os.IsNotExist(err) {
+		t.Fatalf("first generation has a backup: %v", err)
+	}
+
+	if err := writeState(path, stateScopes, []string{"b.com"}); err != nil {
+		t.Fatal(err)
+	}
+	assertState(t, path, []string{"b.com"})
+	assertState(t, path+backupSuffix, []string{"a.com"})
+
+	// A damaged current file must not replace the good backup.
+	writeFile(t, path, `["c.c`)
+	if err := writeState(path, stateScopes, []string{"d.com"}); err != nil {
+		t.Fatal(err)
+	}
+	assertState(t, path, []string{"d.com"})
+	assertState(t, path+backupSuffix, []string{"a.com"})
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Fatalf("temporary file %s left behind", entry.Name())
+		}
+	}
+}
+
+func TestWriteSyncedFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "Scopes.json")
+
+	err := writeSynced(path, []byte(`[]`))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("error = %v, want a missing directory", err)
+	}
+}
+
+func assertState(t *testing.T, path string, want []string) {
+	t.Helper()
+
+	var got []string
+	if _, err := decodeState([]byte(readFile(t, path)), stateScopes, &got); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s holds %v, want %v", path, got, want)
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
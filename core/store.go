@@ -0,0 +1,127 @@
+package core
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+// Storages lists the backends state can be kept in.
+var Storages = []string{"json", "sqlite"}
+
+// Run describes one pass of a monitor; everything it observed is recorded under it.
+type Run struct {
+	ID     string
+	Source string
+	Time   time.Time
+}
+
+// Store keeps what the monitors observed. The latest observations are what the next run is compared against.
+type Store interface {
+	// Scopes returns the in-scope URL assets of the last recorded run, or nothing if no run was recorded yet.
+	Scopes() ([]string, error)
+	// RecordScopes starts recording the programs and scope items seen by a run. They are added one at a time, so a
+	// run never has to hold the whole dataset, and stored once the recorder is committed.
+	RecordScopes(run Run) (ScopeRecorder, error)
+	// Services returns the services of the last recorded run, or nothing if no run was recorded yet.
+	Services() ([]model.Sub, error)
+	// SaveServices records the subdomains and services seen by a run.
+	SaveServices(run Run, subdomains []string, services []model.Sub) error
+	Close() error
+}
+
+// ScopeRecorder collects the programs of one scope run. Nothing is stored unless Commit succeeds; Discard abandons
+// the run, and is harmless after Commit.
+type ScopeRecorder interface {
+	Add(program model.JsonData) error
+	Commit() error
+	Discard()
+}
+
+// OpenStore function opens the storage backend selected by the options.
+func OpenStore(o *Options) (Store, error) {
+	if o.Storage == "sqlite" {
+		return OpenSQLiteStore(filepath.Join(o.DataDir, databaseName))
+	}
+
+	return NewJSONStore(o.DataDir), nil
+}
+
+// JSONStore keeps only the latest run of each monitor, as JSON files in Dir.
+type JSONStore struct {
+	Dir string
+}
+
+// NewJSONStore function returns a store writing its files to dir.
+func NewJSONStore(dir string) *JSONStore {
+	return &JSONStore{Dir: dir}
+}
+
+// Scopes function reads the assets saved by the last run from Scopes.json.
+func (j *JSONStore) Scopes() ([]string, error) {
+	var subs []string
+	err := j.read("Scopes.json", stateScopes, &subs)
+	return subs, err
+}
+
+// RecordScopes function returns a recorder that keeps only the assets of the programs added to it, and overwrites
+// Scopes.json with them on Commit.
+func (j *JSONStore) RecordScopes(run Run) (ScopeRecorder, error) {
+	return &jsonScopeRecorder{store: j, assets: []string{}}, nil
+}
+
+// Services function reads the services saved by the last run from Subs.json.
+func (j *JSONStore) Services() ([]model.Sub, error) {
+	var subs []model.Sub
+	err := j.read("Subs.json", stateServices, &subs)
+	return subs, err
+}
+
+// SaveServices function overwrites Subs.json with the services of the run.
+func (j *JSONStore) SaveServices(run Run, subdomains []string, services []model.Sub) error {
+	return j.write("Subs.json", stateServices, services)
+}
+
+func (j *JSONStore) Close() error {
+	return nil
+}
+
+type jsonScopeRecorder struct {
+	store  *JSONStore
+	assets []string
+}
+
+func (r *jsonScopeRecorder) Add(program model.JsonData) error {
+	r.assets = append(r.assets, programAssets(program)...)
+	return nil
+}
+
+func (r *jsonScopeRecorder) Commit() error {
+	return r.store.write("Scopes.json", stateScopes, r.assets)
+}
+
+func (r *jsonScopeRecorder) Discard() {
+	r.assets = nil
+}
+
+// read function loads a state file into value, leaving it empty when there is none yet.
+func (j *JSONStore) read(name string, kind string, value any) error {
+	return readState(filepath.Join(j.Dir, name), kind, value)
+}
+
+func (j *JSONStore) write(name string, kind string, value any) error {
+	return writeState(filepath.Join(j.Dir, name), kind, value)
+}
+
+// programAssets function lists the URL assets a program accepts submissions for.
+func programAssets(program model.JsonData) []string {
+	var subs []string
+	for _, item := range program.Targets.InScope {
+		if item.AssetType == "URL" && item.EligibleForSubmission {
+			subs = append(subs, item.AssetIdentifier)
+		}
+	}
+
+	return subs
+}
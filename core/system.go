@@ -1,33 +1,48 @@
 package core
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/NImaism/ScopeDetective/model"
-	"io/ioutil"
-	"net/http"
+	"hash/fnv"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
-	"sync"
-	"syscall"
 	"time"
 )
 
+// hackerOneDataset is the daily export of every HackerOne program and its scope.
+const hackerOneDataset = "https://raw.githubusercontent.com/arkadiyt/bounty-targets-data/main/data/hackerone_data.json"
+
+// datasetState identifies the last version of the dataset that was processed.
+type datasetState struct {
+	ETag   string `json:"etag,omitempty"`
+	SHA256 string `json:"sha256"`
+}
+
 type System struct {
 	NotificationSystem *Messager
+	Store              Store
+	Fetcher            *Fetcher
 	Options            *Options
 }
 
-// New function Creates a new system instance with the specified notification system and options.
-func New(NotificationSystem *Messager, Option Options) *System {
+// New function Creates a new system instance with the specified notification system, store and options.
+func New(NotificationSystem *Messager, Store Store, Option Options) *System {
 	return &System{
 		NotificationSystem: NotificationSystem,
+		Store:              Store,
+		Fetcher:            NewFetcher(),
 		Options:            &Option,
 	}
 }
 
 // Run function Runs the system in a loop, periodically fetching data and sending notifications based on calculations.
+// A cycle that fails is logged and skipped; the next one starts on schedule.
 func (s *System) Run() {
 	ticker := time.NewTicker(time.Duration(s.Options.Delay+3) * time.Minute)
 	defer ticker.Stop()
@@ -36,201 +51,228 @@ func (s *System) Run() {
 	for {
 		select {
 		case <-ticker.C:
-			for _, v := range s.calculateData(s.Pull()) {
-				s.NotificationSystem.sendMessage(v)
-				time.Sleep(2 * time.Second)
+			if err := s.Cycle(); err != nil {
+				fmt.Printf("\033[31m[!] HackerOne Cycle Skipped: %s\033[0m\n", err)
+				s.NotificationSystem.sendLog(fmt.Sprintf("```yaml\n - ⚠️ Detective Skips A Cycle: %s ```", err))
 			}
+			s.NotificationSystem.Wait()
 		}
 	}
 }
 
-// Pull function pulls the content of the "hackerone_data.json" file from the specified URL and returns it as a byte array.
-func (s *System) Pull() []byte {
-	resp, err := http.Get("https://raw.githubusercontent.com/arkadiyt/bounty-targets-data/main/data/hackerone_data.json")
-	if err != nil {
-		fmt.Println("\033[31m[!] Network Error\033[0m")
-		syscall.Exit(0)
+// Cycle function pulls the dataset once and notifies every new asset. A dataset that did not change since the last
+// processed one, by its ETag or its content, is not processed again. The dataset is downloaded to a temporary file
+// in the data directory rather than into memory.
+func (s *System) Cycle() error {
+	path := filepath.Join(s.Options.DataDir, "dataset.json")
+
+	var last datasetState
+	if err := readState(path, stateDataset, &last); err != nil {
+		return err
 	}
-	defer resp.Body.Close()
 
-	data, err := ioutil.ReadAll(resp.Body)
+	file, err := os.CreateTemp(s.Options.DataDir, ".dataset-*.tmp")
 	if err != nil {
-		fmt.Println("\033[31m[!] Read File Error\033[0m")
-		syscall.Exit(0)
+		return err
 	}
+	defer os.Remove(file.Name())
+	defer file.Close()
 
-	return data
-}
-
-// CalculateData function processes a byte slice of data to calculate values using concurrent processing, goroutines, and a wait group. It prints out messages to indicate progress and results.
-func (s *System) calculateData(data []byte) []model.Message {
-	fmt.Println("\033[32m[+] System Started !\033[0m")
-	s.NotificationSystem.sendLog("```yaml\n - 🔍 Detective Begins Document Inspection ! ```")
-
-	var Data []model.JsonData
-	var wg sync.WaitGroup
-
-	CollectedMessage := model.StoredData{Data: []model.Message{}, Subs: []string{}}
-	_ = json.Unmarshal(data, &Data)
-	SavedData := s.openData(Data)
-
-	for _, Pr := range Data {
-		wg.Add(1)
-		go func(program model.JsonData) {
-			CollectedMessage.Mutex.Lock()
-			for _, item := range program.Targets.InScope {
-				if item.AssetType == "URL" && item.EligibleForSubmission {
-					CollectedMessage.Subs = append(CollectedMessage.Subs, item.AssetIdentifier)
-					if !Contains(SavedData, item.AssetIdentifier) && (s.Options.Vdp || item.EligibleForBounty) {
-						CollectedMessage.Data = append(CollectedMessage.Data, model.Message{
-							SubDomain:   item.AssetIdentifier,
-							Owner:       program.Name,
-							Url:         program.URL,
-							MaxSeverity: item.MaxSeverity,
-						})
-					}
-				}
-			}
-			CollectedMessage.Mutex.Unlock()
-			wg.Done()
-		}(Pr)
+	etag, err := s.Pull(last.ETag, file)
+	if errors.Is(err, errNotModified) {
+		fmt.Println("\u001B[35m[-] Dataset Not Modified \u001B[0m")
+		return nil
+	}
+	if err != nil {
+		return err
 	}
 
-	wg.Wait()
+	hash := sha256.New()
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(hash, file); err != nil {
+		return fmt.Errorf("hash dataset: %w", err)
+	}
+	current := datasetState{ETag: etag, SHA256: hex.EncodeToString(hash.Sum(nil))}
 
-	s.saveData(CollectedMessage.Subs)
-	if len(CollectedMessage.Data) == 0 {
-		s.NotificationSystem.sendLog("```yaml\n - 📜 Detective Discovers No Pertinent Evidence !```")
-		fmt.Println("\u001B[35m[-] No Change \u001B[0m")
+	if current.SHA256 != last.SHA256 {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := s.calculateData(file); err != nil {
+			return err
+		}
 	} else {
-
-		s.NotificationSystem.sendLog("```yaml\n - 🔮 Detective Makes Significant Discovery !```")
-		fmt.Printf("\u001B[35m[+] %d Change \u001B[0m\n", len(CollectedMessage.Data))
+		fmt.Println("\u001B[35m[-] Dataset Unchanged \u001B[0m")
 	}
 
-	return CollectedMessage.Data
+	// Only recorded once processed, so a failed cycle downloads and processes the same version again.
+	return writeState(path, stateDataset, current)
 }
 
-// SaveData function saves data to a JSON file for future retrieval.
-func (s *System) saveData(Subs []string) {
-	jsonData, err := json.Marshal(Subs)
-	if err != nil {
-		fmt.Println("\033[31m[!] Marshal Data Error\033[0m")
-		syscall.Exit(0)
+// Pull function downloads the "hackerone_data.json" file from the specified URL into file and returns its ETag. When
+// the file still has the given ETag, it returns errNotModified instead.
+func (s *System) Pull(etag string, file *os.File) (string, error) {
+	etag, err := s.Fetcher.Download(hackerOneDataset, etag, file, "application/json", "text/plain")
+	if err != nil && !errors.Is(err, errNotModified) {
+		return "", fmt.Errorf("pull dataset: %w", err)
 	}
 
-	if err := os.MkdirAll("data", 0755); err != nil {
-		panic(err)
+	return etag, err
+}
+
+// CalculateData function decodes the dataset one program at a time, comparing each against the hashed set of saved
+// assets and recording it as it goes, so memory use stays flat as the dataset grows. It queues an event for every
+// new asset before the run is committed, and prints out messages to indicate progress and results.
+func (s *System) calculateData(data io.Reader) error {
+	fmt.Println("\033[32m[+] System Started !\033[0m")
+	s.NotificationSystem.sendLog("```yaml\n - 🔍 Detective Begins Document Inspection ! ```")
+
+	runID := newRunID()
+
+	SavedData, err := s.openData()
+	if err != nil {
+		return err
 	}
 
-	filePath := filepath.Join("data", "Scopes.json")
-	file, err := os.Create(filePath)
+	recorder, err := s.Store.RecordScopes(Run{ID: runID, Source: "HackerOne", Time: time.Now()})
 	if err != nil {
-		fmt.Println("\033[31m[!] Save Pulled File Error\033[0m")
-		syscall.Exit(0)
+		return fmt.Errorf("save scopes: %w", err)
 	}
-	defer file.Close()
+	defer recorder.Discard()
 
-	if _, err := file.Write(jsonData); err != nil {
-		fmt.Println("\033[31m[!] Save Pulled File Error\033[0m")
-		syscall.Exit(0)
+	var CollectedMessage []model.Event
+	decoder := json.NewDecoder(data)
+	if err := expectDelim(decoder, '['); err != nil {
+		return fmt.Errorf("decode dataset: %w", err)
 	}
-}
 
-// OpenData function opens or creates a JSON file to store and retrieve data.
-func (s *System) openData(Data []model.JsonData) []string {
-	if _, err := os.Stat("data/Scopes.json"); os.IsNotExist(err) {
-		var Subs []string
-		for _, program := range Data {
-			for _, item := range program.Targets.InScope {
-				if item.AssetType == "URL" {
-					Subs = append(Subs, item.AssetIdentifier)
-				}
-			}
+	for decoder.More() {
+		var program model.JsonData
+		if err := decoder.Decode(&program); err != nil {
+			return fmt.Errorf("decode dataset: %w", err)
 		}
 
-		jsonData, err := json.Marshal(Subs)
-		if err != nil {
-			fmt.Println("\033[31m[!] Marshal Data Error\033[0m")
-			syscall.Exit(0)
+		if SavedData != nil {
+			CollectedMessage = append(CollectedMessage, s.newAssets(runID, program, SavedData)...)
 		}
 
-		if err := os.MkdirAll("data", 0755); err != nil {
-			fmt.Println("\033[31m[!] Create Directory File Error\033[0m")
-			syscall.Exit(0)
+		if err := recorder.Add(program); err != nil {
+			return fmt.Errorf("save scopes: %w", err)
 		}
+	}
 
-		filePath := filepath.Join("data", "Scopes.json")
-		file, err := os.Create(filePath)
-		if err != nil {
-			fmt.Println("\033[31m[!] Save Pulled File Error\033[0m")
-			syscall.Exit(0)
+	if err := expectDelim(decoder, ']'); err != nil {
+		return fmt.Errorf("decode dataset: %w", err)
+	}
 
+	for _, event := range CollectedMessage {
+		if err = s.NotificationSystem.Notify(event); err != nil {
+			break
 		}
-		defer file.Close()
+	}
+	s.NotificationSystem.EndRun(runID)
 
-		if _, err := file.Write(jsonData); err != nil {
-			fmt.Println("\033[31m[!] Write Pulled File Error\033[0m")
-			syscall.Exit(0)
-		}
+	// An asset whose alert was not queued must not be saved as seen; the deferred Discard drops the run.
+	if err != nil {
+		return err
+	}
+
+	if err := recorder.Commit(); err != nil {
+		return fmt.Errorf("save scopes: %w", err)
+	}
 
-		return Subs
+	if len(CollectedMessage) == 0 {
+		s.NotificationSystem.sendLog("```yaml\n - 📜 Detective Discovers No Pertinent Evidence !```")
+		fmt.Println("\u001B[35m[-] No Change \u001B[0m")
 	} else {
-		file, err := os.OpenFile("data/Scopes.json", os.O_RDWR, 0644)
-		if err != nil {
-			fmt.Println("\033[31m[!] Open Pulled File Error\033[0m")
-			syscall.Exit(0)
-		}
-		defer file.Close()
 
-		data, err := ioutil.ReadAll(file)
-		if err != nil {
-			fmt.Println("\033[31m[!] Error reading file\033[0m")
-			syscall.Exit(0)
-		}
+		s.NotificationSystem.sendLog("```yaml\n - 🔮 Detective Makes Significant Discovery !```")
+		fmt.Printf("\u001B[35m[+] %d Change \u001B[0m\n", len(CollectedMessage))
+	}
 
-		var SavedSubs []string
-		err = json.Unmarshal(data, &SavedSubs)
-		if err != nil {
-			fmt.Println("\033[31m[!] Error unmarshalling JSON data\033[0m")
-			fmt.Println("\033[34m[+] Working on the problem\033[0m")
+	return nil
+}
 
-			err = file.Truncate(0)
-			if err != nil {
-				fmt.Println("\u001B[31m[!] Error deleting file content\u001B[0m")
-				syscall.Exit(0)
+// newAssets function returns an event for every asset of the program that is open for submission, was not saved by
+// the last run, and pays a bounty unless VDPs are wanted too.
+func (s *System) newAssets(runID string, program model.JsonData, SavedData assetSet) []model.Event {
+	var events []model.Event
+	for _, item := range program.Targets.InScope {
+		if item.AssetType == "URL" && item.EligibleForSubmission {
+			if !SavedData.Has(item.AssetIdentifier) && (s.Options.Vdp || item.EligibleForBounty) {
+				events = append(events, model.Event{
+					Type:        model.EventScopeNew,
+					Source:      "HackerOne",
+					RunID:       runID,
+					Program:     program.Name,
+					ProgramURL:  program.URL,
+					Asset:       item.AssetIdentifier,
+					AssetType:   item.AssetType,
+					Severity:    item.MaxSeverity,
+					Bounty:      item.EligibleForBounty,
+					Instruction: item.Instruction,
+				})
 			}
+		}
+	}
 
-			var Subs []string
-			for _, program := range Data {
-				for _, item := range program.Targets.InScope {
-					if item.AssetType == "URL" {
-						Subs = append(Subs, item.AssetIdentifier)
-					}
-				}
-			}
+	return events
+}
 
-			jsonData, err := json.Marshal(Subs)
-			if err != nil {
-				fmt.Println("\033[31m[!] Marshal Data Error\033[0m")
-				syscall.Exit(0)
-			}
+// OpenData function returns the assets recorded by the last run as a hashed set, or nil when nothing was recorded
+// yet and this run is the baseline.
+func (s *System) openData() (assetSet, error) {
+	SavedSubs, err := s.Store.Scopes()
+	if err != nil {
+		return nil, fmt.Errorf("open saved scopes: %w", err)
+	}
 
-			_, err = file.Write(jsonData)
-			if err != nil {
-				fmt.Println("\033[31m[!] Write Pulled File Error\033[0m")
-				syscall.Exit(0)
-			}
+	if len(SavedSubs) == 0 {
+		fmt.Println("\033[34m[+] No Saved Scopes, Using This Run As Baseline\033[0m")
+		return nil, nil
+	}
 
-			fmt.Println("\033[34m[+] Problem has been solved\033[0m")
-			return Subs
-		} else {
-			if len(SavedSubs) == 0 {
-				syscall.Exit(0)
-			}
-			fmt.Println("\033[33m[+] " + "Count: " + strconv.Itoa(len(SavedSubs)) + "\033[0m")
-			return SavedSubs
-		}
+	fmt.Println("\033[33m[+] " + "Count: " + strconv.Itoa(len(SavedSubs)) + "\033[0m")
+	return newAssetSet(SavedSubs), nil
+}
+
+// assetSet holds assets as 64-bit FNV-1a hashes, a few bytes each however long the asset is. A collision would hide
+// one new asset, which is not a practical concern at the size of the dataset.
+type assetSet map[uint64]struct{}
+
+// newAssetSet function hashes every asset into a new set.
+func newAssetSet(assets []string) assetSet {
+	set := make(assetSet, len(assets))
+	for _, asset := range assets {
+		set[hashAsset(asset)] = struct{}{}
+	}
 
+	return set
+}
+
+// Has function reports whether the asset is in the set.
+func (a assetSet) Has(asset string) bool {
+	_, ok := a[hashAsset(asset)]
+	return ok
+}
+
+func hashAsset(asset string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(asset))
+	return hash.Sum64()
+}
+
+// expectDelim function reads the next token of the decoder and fails unless it is the given delimiter.
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
 	}
+	if token != delim {
+		return fmt.Errorf("expected %s, found %v", delim, token)
+	}
+
+	return nil
 }
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/NImaism/ScopeDetective/model"
+)
+
+// Discord's error code for a thread or channel that no longer exists.
+const unknownChannel = "10003"
+
+// ThreadStore remembers the forum thread created for every program or domain, per destination. A read-only store
+// keeps changes in memory and never saves them.
+type ThreadStore struct {
+	path     string
+	readOnly bool
+	mutex    sync.Mutex
+	threads  map[string]map[string]string
+}
+
+// NewThreadStore function loads the thread IDs saved at path, starting empty if there are none or they cannot be
+// read. Thread IDs written by a newer release are an error, so they are not overwritten.
+func NewThreadStore(path string) (*ThreadStore, error) {
+	return newThreadStore(path, false)
+}
+
+// NewReadOnlyThreadStore function loads the thread IDs saved at path like NewThreadStore, but neither upgrades nor
+// restores the file while loading, and never saves changes.
+func NewReadOnlyThreadStore(path string) (*ThreadStore, error) {
+	return newThreadStore(path, true)
+}
+
+func newThreadStore(path string, readOnly bool) (*ThreadStore, error) {
+	store := &ThreadStore{path: path, readOnly: readOnly, threads: make(map[string]map[string]string)}
+
+	read := readState
+	if readOnly {
+		read = peekState
+	}
+
+	if err := read(path, stateThreads, &store.threads); err != nil {
+		if errors.Is(err, errFutureState) {
+			return nil, err
+		}
+		fmt.Printf("\033[31m[!] Error loading thread IDs, starting new threads: %s\033[0m\n", err)
+		store.threads = make(map[string]map[string]string)
+	}
+
+	return store, nil
+}
+
+// Get function returns the thread ID of a key in a destination, or an empty string.
+func (t *ThreadStore) Get(destination string, key string) string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.threads[destination][key]
+}
+
+// Set function records a thread ID and saves the store.
+func (t *ThreadStore) Set(destination string, key string, id string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.threads[destination] == nil {
+		t.threads[destination] = make(map[string]string)
+	}
+	t.threads[destination][key] = id
+	t.save()
+}
+
+// Forget function drops a thread that no longer exists and saves the store.
+func (t *ThreadStore) Forget(destination string, key string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.threads[destination], key)
+	t.save()
+}
+
+func (t *ThreadStore) save() {
+	if t.readOnly {
+		return
+	}
+
+	if err := writeState(t.path, stateThreads, t.threads); err != nil {
+		fmt.Printf("\033[31m[!] Save Thread IDs Error: %s\033[0m\n", err)
+	}
+}
+
+// postedMessage is the part of Discord's ?wait=true answer needed to find the message again.
+type postedMessage struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+}
+
+// post function delivers a payload to one destination and returns the created message. Forum destinations get one
+// thread per key: the saved thread is reused, and a new one is created and remembered when there is none or it was
+// deleted.
+func (m *Messager) post(name string, destination Destination, key string, payload model.DiscordMessage, files ...Attachment) (postedMessage, error) {
+	var posted postedMessage
+	webhook := withQuery(destination.Webhook, "wait", "true")
+
+	if !destination.Forum {
+		response, err := m.delivery.Send(webhook, payload, files...)
+		if err == nil {
+			_ = json.Unmarshal(response, &posted)
+		}
+		return posted, err
+	}
+
+	if id := m.threads.Get(name, key); id != "" {
+		response, err := m.delivery.Send(withQuery(webhook, "thread_id", id), payload, files...)
+		if !isUnknownThread(err) {
+			if err == nil {
+				_ = json.Unmarshal(response, &posted)
+			}
+			return posted, err
+		}
+		m.threads.Forget(name, key)
+	}
+
+	payload.ThreadName = truncate(threadName(key), 100)
+	response, err := m.delivery.Send(webhook, payload, files...)
+	if err != nil {
+		return posted, err
+	}
+
+	if err := json.Unmarshal(response, &posted); err == nil && posted.ChannelID != "" {
+		m.threads.Set(name, key, posted.ChannelID)
+	}
+
+	return posted, nil
+}
+
+// threadKey function returns the group shared by all events, or "digest" when they are mixed.
+func threadKey(events []model.Event) string {
+	key := groupKey(events[0])
+	for _, event := range events[1:] {
+		if groupKey(event) != key {
+			return "digest"
+		}
+	}
+
+	return key
+}
+
+// threadName function turns a thread key into the title shown in the forum.
+func threadName(key string) string {
+	switch key {
+	case "log":
+		return "ScopeDetective Log"
+	case "digest":
+		return "ScopeDetective Digest"
+	case "test":
+		return "ScopeDetective Test"
+	}
+
+	if _, name, ok := strings.Cut(key, ":"); ok && name != "" {
+		return name
+	}
+
+	return key
+}
+
+// withQuery function adds a query parameter to a webhook URL.
+func withQuery(webhook string, key string, value string) string {
+	parsed, err := url.Parse(webhook)
+	if err != nil {
+		return webhook
+	}
+
+	query := parsed.Query()
+	query.Set(key, value)
+	parsed.RawQuery = query.Encode()
+
+	return parsed.String()
+}
+
+func isUnknownThread(err error) bool {
+	var status *statusError
+	if !errors.As(err, &status) {
+		return false
+	}
+
+	return status.Status == 404 || strings.Contains(status.Body, unknownChannel)
+}
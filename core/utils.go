@@ -1,6 +1,11 @@
 package core
 
-import "strconv"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
 
 // Contains function checks if an item exists in a list.
 func Contains(list []string, item string) bool {
@@ -29,3 +34,11 @@ func intListToStringList(intList []int) []string {
 	}
 	return stringList
 }
+
+// newRunID function returns an identifier for one monitoring cycle, readable and unique enough to correlate its events.
+func newRunID() string {
+	suffix := make([]byte, 2)
+	_, _ = rand.Read(suffix)
+
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
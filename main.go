@@ -10,20 +10,76 @@ import (
 // main function sets up the program, handles interruptions, and runs the system.
 func main() {
 	options := core.NewParser()
-	options.Parse()
+	if err := options.Parse(); err != nil {
+		fail("Options Error", err)
+	}
 
-	system := core.New(core.NewMessager(options), *options)
-	fresh := core.NewFresh(core.NewMessager(options), *options)
+	switch options.Command {
+	case "test-notify":
+		if err := core.TestNotify(options); err != nil {
+			fail("Test Notify Failed", err)
+		}
+		return
+	case "history":
+		if err := core.History(options); err != nil {
+			fail("History Error", err)
+		}
+		return
+	case "export":
+		if err := core.Export(options); err != nil {
+			fail("Export Error", err)
+		}
+		return
+	}
+
+	lock, err := core.LockDataDir(options.DataDir)
+	if err != nil {
+		fail("Lock Error", err)
+	}
+	defer lock.Release()
+
+	if options.Command == "import" {
+		if err := core.Import(options); err != nil {
+			fail("Import Error", err)
+		}
+		return
+	}
+
+	if err := core.CheckWebhooks(options); err != nil {
+		fail("Webhook Check Failed", err)
+	}
+
+	store, err := core.OpenStore(options)
+	if err != nil {
+		fail("Open Storage Error", err)
+	}
+	defer store.Close()
+
+	messager, err := core.NewMessager(options)
+	if err != nil {
+		fail("Notifier Error", err)
+	}
+	system := core.New(messager, store, *options)
+	fresh := core.NewFresh(messager, store, *options)
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	go func() {
 		for range c {
 			fmt.Println("\n\033[35m[+] Bye See You Later\033[0m")
+			store.Close()
 			os.Exit(1)
 		}
 	}()
 
-	go fresh.Run()
+	if len(options.WildCards) > 0 {
+		go fresh.Run()
+	}
 	system.Run()
 }
+
+// fail function prints an error and exits with a failure status.
+func fail(context string, err error) {
+	fmt.Printf("\033[31m[!] %s: %s\033[0m\n", context, err)
+	os.Exit(1)
+}
@@ -1,10 +1,18 @@
 package model
 
 type DiscordMessage struct {
-	Content   string         `json:"content,omitempty"`
-	Username  string         `json:"username,omitempty"`
-	AvatarUrl string         `json:"avatar_url,omitempty"`
-	Embeds    []DiscordEmbed `json:"embeds,omitempty"`
+	Content         string                  `json:"content,omitempty"`
+	Username        string                  `json:"username,omitempty"`
+	AvatarUrl       string                  `json:"avatar_url,omitempty"`
+	Embeds          []DiscordEmbed          `json:"embeds,omitempty"`
+	AllowedMentions *DiscordAllowedMentions `json:"allowed_mentions,omitempty"`
+	ThreadName      string                  `json:"thread_name,omitempty"`
+}
+
+type DiscordAllowedMentions struct {
+	Parse []string `json:"parse"`
+	Roles []string `json:"roles,omitempty"`
+	Users []string `json:"users,omitempty"`
 }
 
 type DiscordEmbed struct {
@@ -14,6 +22,7 @@ type DiscordEmbed struct {
 	Color       int                 `json:"color,omitempty"`
 	Timestamp   string              `json:"timestamp,omitempty"`
 	Fields      []DiscordEmbedField `json:"fields,omitempty"`
+	Footer      *DiscordEmbedFooter `json:"footer,omitempty"`
 }
 
 type DiscordEmbedField struct {
@@ -21,3 +30,7 @@ type DiscordEmbedField struct {
 	Value  string `json:"value"`
 	Inline bool   `json:"inline"`
 }
+
+type DiscordEmbedFooter struct {
+	Text string `json:"text"`
+}
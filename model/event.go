@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+type EventType string
+
+const (
+	EventLog           EventType = "log"
+	EventScopeNew      EventType = "scope_new"
+	EventServiceNew    EventType = "service_new"
+	EventServiceStatus EventType = "service_status"
+	EventServiceCode   EventType = "service_code"
+	EventServiceWords  EventType = "service_words"
+	EventServiceTech   EventType = "service_technology"
+	EventServiceTitle  EventType = "service_title"
+)
+
+// Event is a single notification produced by System or Fresh and persisted until it is delivered.
+type Event struct {
+	ID          string    `json:"id"`
+	Type        EventType `json:"type"`
+	Time        time.Time `json:"time"`
+	Source      string    `json:"source,omitempty"`
+	RunID       string    `json:"run_id,omitempty"`
+	Program     string    `json:"program,omitempty"`
+	ProgramURL  string    `json:"program_url,omitempty"`
+	Domain      string    `json:"domain,omitempty"`
+	Asset       string    `json:"asset,omitempty"`
+	AssetType   string    `json:"asset_type,omitempty"`
+	Severity    string    `json:"severity,omitempty"`
+	Bounty      bool      `json:"bounty,omitempty"`
+	Instruction string    `json:"instruction,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	Service     *Sub      `json:"service,omitempty"`
+	Old         string    `json:"old,omitempty"`
+	New         string    `json:"new,omitempty"`
+}
@@ -1,7 +1,5 @@
 package model
 
-import "sync"
-
 type JsonData struct {
 	AllowsBountySplitting             bool   `json:"allows_bounty_splitting"`
 	AverageTimeToBountyAwarded        *int   `json:"average_time_to_bounty_awarded"`
@@ -22,19 +20,6 @@ type JsonData struct {
 	} `json:"targets"`
 }
 
-type StoredData struct {
-	Data  []Message
-	Subs  []string
-	Mutex sync.Mutex
-}
-
-type Message struct {
-	SubDomain   string
-	Owner       string
-	Url         string
-	MaxSeverity string
-}
-
 type Scope struct {
 	AssetIdentifier            string `json:"asset_identifier"`
 	AssetType                  string `json:"asset_type"`